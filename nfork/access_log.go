@@ -0,0 +1,249 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package nfork
+
+import (
+	"github.com/datacratic/goklog/klog"
+
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Formats supported by AccessLog.
+const (
+	AccessLogCommon = "common"
+	AccessLogJSON   = "json"
+)
+
+// AccessLogStdout is the path used to write an access log to stdout.
+const AccessLogStdout = "-"
+
+// AccessRecord describes a request processed by an inbound along with the
+// outcome of each of its outbounds.
+type AccessRecord struct {
+	Time       time.Time
+	RemoteAddr string
+	Method     string
+	Path       string
+	Proto      string
+	RequestID  string
+
+	// Status is the HTTP status code sent back to the client and Event holds
+	// the inbound-level outcome of the request.
+	Status int
+	Event  Event
+
+	// Active is the name of the active outbound and Outbounds contains the
+	// outcome of each outbound, including the active one.
+	Active    string
+	Outbounds map[string]Event
+}
+
+// AccessLog appends a record of each request processed by an inbound to a file
+// either in the Common Log Format or as JSON lines. The Common Log Format is
+// extended with the latency of the request, the name of the active outbound,
+// a summary of the outcome of each shadow outbound and the request ID if any.
+type AccessLog struct {
+
+	// Path is the file where the records are appended or AccessLogStdout.
+	Path string
+
+	// Format is either AccessLogCommon or AccessLogJSON. Defaults to
+	// AccessLogCommon.
+	Format string
+
+	initialize sync.Once
+
+	mutex  sync.Mutex
+	writer io.Writer
+	file   *os.File
+}
+
+// Validate returns an error if the access log is misconfigured.
+func (accessLog *AccessLog) Validate() error {
+	if len(accessLog.Path) == 0 {
+		return fmt.Errorf("missing access log path")
+	}
+
+	switch accessLog.Format {
+	case "", AccessLogCommon, AccessLogJSON:
+	default:
+		return fmt.Errorf("unknown access log format '%s'", accessLog.Format)
+	}
+
+	return nil
+}
+
+// Init initializes the object.
+func (accessLog *AccessLog) Init() {
+	accessLog.initialize.Do(accessLog.init)
+}
+
+func (accessLog *AccessLog) init() {
+	if len(accessLog.Format) == 0 {
+		accessLog.Format = AccessLogCommon
+	}
+
+	if accessLog.Path == AccessLogStdout {
+		accessLog.writer = os.Stdout
+		return
+	}
+
+	file, err := os.OpenFile(accessLog.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		klog.KPrintf("accesslog.error", "unable to open '%s': %s", accessLog.Path, err)
+		return
+	}
+
+	accessLog.file = file
+	accessLog.writer = file
+}
+
+// Close closes the underlying file. Records written after the access log is
+// closed are dropped.
+func (accessLog *AccessLog) Close() {
+	accessLog.Init()
+	accessLog.mutex.Lock()
+	defer accessLog.mutex.Unlock()
+
+	if accessLog.file != nil {
+		accessLog.file.Close()
+		accessLog.file = nil
+	}
+	accessLog.writer = nil
+}
+
+// Write appends the given record to the access log.
+func (accessLog *AccessLog) Write(record *AccessRecord) {
+	accessLog.Init()
+
+	var line []byte
+	if accessLog.Format == AccessLogJSON {
+		line = formatAccessJSON(record)
+	} else {
+		line = formatAccessCommon(record)
+	}
+
+	accessLog.mutex.Lock()
+	defer accessLog.mutex.Unlock()
+
+	if accessLog.writer == nil {
+		return
+	}
+
+	if _, err := accessLog.writer.Write(line); err != nil {
+		klog.KPrintf("accesslog.error", "unable to write to '%s': %s", accessLog.Path, err)
+	}
+}
+
+func (record *AccessRecord) shadows() (names []string) {
+	for outbound := range record.Outbounds {
+		if outbound != record.Active {
+			names = append(names, outbound)
+		}
+	}
+	sort.Strings(names)
+	return
+}
+
+func formatAccessCommon(record *AccessRecord) []byte {
+	host := record.RemoteAddr
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	size := "-"
+	if record.Event.ResponseBytes > 0 {
+		size = fmt.Sprintf("%d", record.Event.ResponseBytes)
+	}
+
+	buffer := new(bytes.Buffer)
+	fmt.Fprintf(buffer, "%s - - [%s] \"%s %s %s\" %d %s %s %s",
+		host, record.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		record.Method, record.Path, record.Proto,
+		record.Status, size, record.Event.Latency, record.Active)
+
+	shadows := record.shadows()
+	if len(shadows) == 0 {
+		buffer.WriteString(" -")
+	}
+
+	for i, outbound := range shadows {
+		event := record.Outbounds[outbound]
+		if i == 0 {
+			buffer.WriteString(" ")
+		} else {
+			buffer.WriteString(",")
+		}
+		fmt.Fprintf(buffer, "%s=%s:%s", outbound, event.Outcome(), event.Latency)
+	}
+
+	if len(record.RequestID) > 0 {
+		buffer.WriteString(" ")
+		buffer.WriteString(record.RequestID)
+	}
+
+	buffer.WriteString("\n")
+	return buffer.Bytes()
+}
+
+type accessOutcomeJSON struct {
+	Outcome       string `json:"outcome"`
+	Latency       string `json:"latency"`
+	ResponseBytes int    `json:"responseBytes"`
+}
+
+func formatAccessJSON(record *AccessRecord) []byte {
+	var recordJSON struct {
+		Time          string                       `json:"time"`
+		RemoteAddr    string                       `json:"remoteAddr"`
+		Method        string                       `json:"method"`
+		Path          string                       `json:"path"`
+		Proto         string                       `json:"proto"`
+		RequestID     string                       `json:"requestId,omitempty"`
+		Status        int                          `json:"status"`
+		Latency       string                       `json:"latency"`
+		RequestBytes  int                          `json:"requestBytes"`
+		ResponseBytes int                          `json:"responseBytes"`
+		Active        string                       `json:"active"`
+		Outbounds     map[string]accessOutcomeJSON `json:"outbounds,omitempty"`
+	}
+
+	recordJSON.Time = record.Time.Format(time.RFC3339Nano)
+	recordJSON.RemoteAddr = record.RemoteAddr
+	recordJSON.Method = record.Method
+	recordJSON.Path = record.Path
+	recordJSON.Proto = record.Proto
+	recordJSON.RequestID = record.RequestID
+	recordJSON.Status = record.Status
+	recordJSON.Latency = record.Event.Latency.String()
+	recordJSON.RequestBytes = record.Event.RequestBytes
+	recordJSON.ResponseBytes = record.Event.ResponseBytes
+	recordJSON.Active = record.Active
+
+	if len(record.Outbounds) > 0 {
+		recordJSON.Outbounds = make(map[string]accessOutcomeJSON)
+		for outbound, event := range record.Outbounds {
+			recordJSON.Outbounds[outbound] = accessOutcomeJSON{
+				Outcome:       event.Outcome(),
+				Latency:       event.Latency.String(),
+				ResponseBytes: event.ResponseBytes,
+			}
+		}
+	}
+
+	line, err := json.Marshal(&recordJSON)
+	if err != nil {
+		klog.KPrintf("accesslog.error", "unable to marshal record: %s", err)
+		return nil
+	}
+
+	return append(line, '\n')
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package nfork
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessLogCommon(t *testing.T) {
+	record := &AccessRecord{
+		Time:       time.Date(2014, 10, 10, 13, 55, 36, 0, time.UTC),
+		RemoteAddr: "127.0.0.1:1234",
+		Method:     "GET",
+		Path:       "/a?b=c",
+		Proto:      "HTTP/1.1",
+		Status:     200,
+		Event:      Event{Response: 200, Latency: 12 * time.Millisecond, ResponseBytes: 42},
+		Active:     "s0",
+		Outbounds: map[string]Event{
+			"s0": {Response: 200, Latency: 10 * time.Millisecond},
+			"s2": {Timeout: true, Latency: 50 * time.Millisecond},
+			"s1": {Response: 500, Latency: 5 * time.Millisecond},
+		},
+	}
+
+	exp := "127.0.0.1 - - [10/Oct/2014:13:55:36 +0000] \"GET /a?b=c HTTP/1.1\" 200 42 12ms s0 s1=500:5ms,s2=timeout:50ms\n"
+	if line := string(formatAccessCommon(record)); line != exp {
+		t.Errorf("FAIL: unexpected line\n%s%s", line, exp)
+	}
+
+	record.Outbounds = nil
+	record.Event.ResponseBytes = 0
+
+	exp = "127.0.0.1 - - [10/Oct/2014:13:55:36 +0000] \"GET /a?b=c HTTP/1.1\" 200 - 12ms s0 -\n"
+	if line := string(formatAccessCommon(record)); line != exp {
+		t.Errorf("FAIL: unexpected line\n%s%s", line, exp)
+	}
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nfork")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s0 := &TestService{T: t, Name: "s0"}
+	server0 := httptest.NewServer(s0)
+	defer server0.Close()
+
+	s1 := &TestService{T: t, Name: "s1", Code: http.StatusCreated}
+	server1 := httptest.NewServer(s1)
+	defer server1.Close()
+
+	path := filepath.Join(dir, "access.log")
+
+	inbound := &Inbound{
+		Name:            "bob",
+		Outbound:        map[string]string{"s0": server0.URL, "s1": server1.URL},
+		Active:          "s0",
+		AccessLog:       path,
+		AccessLogFormat: AccessLogJSON,
+	}
+	server := httptest.NewServer(inbound)
+	defer server.Close()
+
+	ExpectInbound(t, server.URL, "POST", "a", "r0", http.StatusOK, "s0")
+	s0.Expect("{POST /a r0}")
+	s1.Expect("{POST /a r0}")
+
+	// Records are written asynchronously once all the outbounds are done.
+	time.Sleep(50 * time.Millisecond)
+	inbound.Close()
+
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("FAIL: unable to read access log: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("FAIL: unexpected records -> %q", lines)
+	}
+
+	var record struct {
+		Method       string `json:"method"`
+		Path         string `json:"path"`
+		Status       int    `json:"status"`
+		RequestBytes int    `json:"requestBytes"`
+		Active       string `json:"active"`
+		Outbounds    map[string]struct {
+			Outcome string `json:"outcome"`
+		} `json:"outbounds"`
+	}
+
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("FAIL: unable to parse record '%s': %s", lines[0], err)
+	}
+
+	if record.Method != "POST" || record.Path != "/a" || record.Status != http.StatusOK || record.RequestBytes != 2 {
+		t.Errorf("FAIL: unexpected record -> %s", lines[0])
+	}
+
+	if record.Active != "s0" || record.Outbounds["s0"].Outcome != "200" || record.Outbounds["s1"].Outcome != "201" {
+		t.Errorf("FAIL: unexpected outcomes -> %s", lines[0])
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package nfork
+
+import (
+	"github.com/datacratic/goklog/klog"
+
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Roles which can be granted to a Credential.
+const (
+	// RoleReader can only use the routes which don't modify anything: the
+	// list, stats, history, codes, errors, stream and tap routes along with
+	// the dashboard and the metrics.
+	RoleReader = "read"
+
+	// RoleAdmin can use all the routes including the ones that add, remove or
+	// activate inbounds and outbounds and reset their stats.
+	RoleAdmin = "admin"
+)
+
+// AuthRealm is the realm sent to clients which aren't authenticated.
+const AuthRealm = "nfork"
+
+// Credential grants a role to either a bearer token or a user and password
+// used with HTTP basic authentication.
+type Credential struct {
+	Token string `json:"token,omitempty"`
+
+	User     string `json:"user,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	// Role is either RoleReader or RoleAdmin.
+	Role string `json:"role"`
+}
+
+// Validate returns an error if one of the Credential invariants are not
+// satisfied.
+func (cred *Credential) Validate() error {
+	if cred.Role != RoleReader && cred.Role != RoleAdmin {
+		return fmt.Errorf("invalid role '%s'", cred.Role)
+	}
+
+	if len(cred.Token) > 0 {
+		if len(cred.User) > 0 || len(cred.Password) > 0 {
+			return fmt.Errorf("credential can't have both a token and a user")
+		}
+		return nil
+	}
+
+	if len(cred.User) == 0 || len(cred.Password) == 0 {
+		return fmt.Errorf("credential requires either a token or a user and password")
+	}
+
+	if strings.Contains(cred.User, ":") {
+		return fmt.Errorf("invalid user '%s'", cred.User)
+	}
+
+	return nil
+}
+
+// name identifies the credential in the logs without revealing its secrets.
+func (cred *Credential) name() string {
+	if len(cred.Token) > 0 {
+		return "token"
+	}
+	return "user " + cred.User
+}
+
+// ReadCredentials reads a JSON array of Credential objects from the given
+// file.
+func ReadCredentials(path string) ([]*Credential, error) {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var creds []*Credential
+	if err := json.Unmarshal(body, &creds); err != nil {
+		return nil, fmt.Errorf("unable to parse credentials '%s': %s", path, err)
+	}
+
+	return creds, nil
+}
+
+// Auth restricts the access to an HTTP handler, typically the one returned by
+// Controller.HTTPHandler, to the requests carrying one of its credentials
+// either as a bearer token or through HTTP basic authentication. Readers can
+// only send GET and HEAD requests while admins can send any requests.
+type Auth struct {
+
+	// Credentials is the list of credentials which are granted access.
+	Credentials []*Credential
+}
+
+// Validate returns an error if one of the Auth invariants are not satisfied.
+func (auth *Auth) Validate() error {
+	if len(auth.Credentials) == 0 {
+		return fmt.Errorf("no credentials")
+	}
+
+	tokens := make(map[string]bool)
+	users := make(map[string]bool)
+
+	for i, cred := range auth.Credentials {
+		if err := cred.Validate(); err != nil {
+			return fmt.Errorf("invalid credential %d: %s", i, err)
+		}
+
+		if len(cred.Token) > 0 {
+			if tokens[cred.Token] {
+				return fmt.Errorf("invalid credential %d: duplicate token", i)
+			}
+			tokens[cred.Token] = true
+
+		} else {
+			if users[cred.User] {
+				return fmt.Errorf("invalid credential %d: duplicate user '%s'", i, cred.User)
+			}
+			users[cred.User] = true
+		}
+	}
+
+	return nil
+}
+
+// Handler wraps the given handler such that only the requests allowed by the
+// credentials are forwarded to it. Requests without valid credentials are
+// rejected with a 401 and requests which aren't allowed by the role of their
+// credential are rejected with a 403.
+func (auth *Auth) Handler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		cred := auth.authenticate(httpReq)
+
+		if cred == nil {
+			klog.KPrintf("auth.denied", "unauthenticated %s %s from %s",
+				httpReq.Method, httpReq.URL.Path, httpReq.RemoteAddr)
+
+			writer.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", AuthRealm))
+			http.Error(writer, "authentication required", http.StatusUnauthorized)
+			return
+		}
+
+		if !authorize(cred.Role, httpReq.Method) {
+			klog.KPrintf("auth.denied", "%s %s %s from %s requires role %s",
+				cred.name(), httpReq.Method, httpReq.URL.Path, httpReq.RemoteAddr, RoleAdmin)
+
+			http.Error(writer, fmt.Sprintf("role %s required", RoleAdmin), http.StatusForbidden)
+			return
+		}
+
+		handler.ServeHTTP(writer, httpReq)
+	})
+}
+
+// authenticate returns the credential matching the Authorization header of
+// the given request or nil if none matches. All the credentials are compared
+// in constant time to avoid leaking which ones exist.
+func (auth *Auth) authenticate(httpReq *http.Request) (result *Credential) {
+	header := httpReq.Header.Get("Authorization")
+	token := ""
+	if strings.HasPrefix(header, "Bearer ") {
+		token = strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	}
+	user, password, basic := httpReq.BasicAuth()
+
+	if len(token) == 0 && !basic {
+		return nil
+	}
+
+	for _, cred := range auth.Credentials {
+		var match bool
+
+		if len(cred.Token) > 0 {
+			match = len(token) > 0 && equal(token, cred.Token)
+		} else {
+			match = basic && equal(user, cred.User) && equal(password, cred.Password)
+		}
+
+		if match && result == nil {
+			result = cred
+		}
+	}
+
+	return
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// authorize returns true if the given role can send requests with the given
+// method.
+func authorize(role, method string) bool {
+	if role == RoleAdmin {
+		return true
+	}
+	return method == "GET" || method == "HEAD"
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package nfork
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuth(t *testing.T) {
+	auth := &Auth{Credentials: []*Credential{
+		{Token: "t-reader", Role: RoleReader},
+		{Token: "t-admin", Role: RoleAdmin},
+		{User: "bob", Password: "secret", Role: RoleReader},
+		{User: "alice", Password: "secret", Role: RoleAdmin},
+	}}
+
+	if err := auth.Validate(); err != nil {
+		t.Fatalf("FAIL: unexpected validation error -> %s", err)
+	}
+
+	handler := auth.Handler(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {}))
+
+	ExpectCode := func(title, method string, setAuth func(*http.Request), exp int) {
+		httpReq := httptest.NewRequest(method, RESTPrefix+"/i0", nil)
+		if setAuth != nil {
+			setAuth(httpReq)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httpReq)
+
+		if recorder.Code != exp {
+			t.Errorf("FAIL(%s): unexpected code -> %d != %d", title, recorder.Code, exp)
+		}
+
+		if exp == http.StatusUnauthorized && len(recorder.Header().Get("WWW-Authenticate")) == 0 {
+			t.Errorf("FAIL(%s): missing WWW-Authenticate header", title)
+		}
+	}
+
+	Token := func(token string) func(*http.Request) {
+		return func(httpReq *http.Request) { httpReq.Header.Set("Authorization", "Bearer "+token) }
+	}
+
+	Basic := func(user, password string) func(*http.Request) {
+		return func(httpReq *http.Request) { httpReq.SetBasicAuth(user, password) }
+	}
+
+	ExpectCode("none", "GET", nil, http.StatusUnauthorized)
+	ExpectCode("bad-token", "GET", Token("t-bob"), http.StatusUnauthorized)
+	ExpectCode("empty-token", "GET", Token(""), http.StatusUnauthorized)
+	ExpectCode("bad-password", "GET", Basic("bob", "nope"), http.StatusUnauthorized)
+	ExpectCode("user-as-token", "GET", Token("bob"), http.StatusUnauthorized)
+
+	ExpectCode("reader-get", "GET", Token("t-reader"), http.StatusOK)
+	ExpectCode("reader-delete", "DELETE", Token("t-reader"), http.StatusForbidden)
+	ExpectCode("reader-put", "PUT", Basic("bob", "secret"), http.StatusForbidden)
+	ExpectCode("reader-basic", "GET", Basic("bob", "secret"), http.StatusOK)
+
+	ExpectCode("admin-get", "GET", Token("t-admin"), http.StatusOK)
+	ExpectCode("admin-delete", "DELETE", Token("t-admin"), http.StatusOK)
+	ExpectCode("admin-post", "POST", Basic("alice", "secret"), http.StatusOK)
+}
+
+func TestAuthValidate(t *testing.T) {
+	for _, test := range []struct {
+		title string
+		creds []*Credential
+	}{
+		{"empty", nil},
+		{"role", []*Credential{{Token: "a", Role: "root"}}},
+		{"missing", []*Credential{{Role: RoleAdmin}}},
+		{"password", []*Credential{{User: "bob", Role: RoleAdmin}}},
+		{"both", []*Credential{{Token: "a", User: "bob", Password: "b", Role: RoleAdmin}}},
+		{"token", []*Credential{{Token: "a", Role: RoleAdmin}, {Token: "a", Role: RoleReader}}},
+		{"user", []*Credential{{User: "bob", Password: "a", Role: RoleAdmin}, {User: "bob", Password: "b", Role: RoleReader}}},
+	} {
+		if err := (&Auth{Credentials: test.creds}).Validate(); err == nil {
+			t.Errorf("FAIL(%s): expected validation error", test.title)
+		}
+	}
+}
+
+func TestReadCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nfork")
+	if err != nil {
+		t.Fatalf("FAIL: unable to create temp dir -> %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "auth.json")
+	body := `[{"token": "a", "role": "read"}, {"user": "bob", "password": "b", "role": "admin"}]`
+	if err := ioutil.WriteFile(path, []byte(body), 0600); err != nil {
+		t.Fatalf("FAIL: unable to write credentials -> %s", err)
+	}
+
+	creds, err := ReadCredentials(path)
+	if err != nil {
+		t.Fatalf("FAIL: unexpected error -> %s", err)
+	}
+
+	if len(creds) != 2 || creds[0].Token != "a" || creds[0].Role != RoleReader ||
+		creds[1].User != "bob" || creds[1].Password != "b" || creds[1].Role != RoleAdmin {
+		t.Errorf("FAIL: unexpected credentials -> %+v, %+v", creds[0], creds[1])
+	}
+
+	if _, err := ReadCredentials(filepath.Join(dir, "bob.json")); err == nil {
+		t.Errorf("FAIL: expected missing file error")
+	}
+}
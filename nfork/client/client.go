@@ -0,0 +1,248 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+// Package client provides a Go client for the REST routes of nfork.Controller.
+package client
+
+import (
+	"github.com/datacratic/gonfork/nfork"
+
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultURL is used if URL is not set in Client.
+const DefaultURL = "http://localhost:9090"
+
+// Error is returned when the controller answers a request with an HTTP status
+// code other than 2xx.
+type Error struct {
+	Method string
+	URL    string
+
+	// Code is the HTTP status code returned by the controller.
+	Code int
+
+	// Message is the body of the response.
+	Message string
+}
+
+// Error returns a description of the error.
+func (err *Error) Error() string {
+	return fmt.Sprintf("%s %s: %d %s: %s", err.Method, err.URL, err.Code, http.StatusText(err.Code), err.Message)
+}
+
+// Client sends requests to the REST routes of an nfork.Controller. Its methods
+// mirror the methods of the controller.
+type Client struct {
+
+	// URL is the base URL of the controller (eg. http://localhost:9090).
+	// Defaults to DefaultURL.
+	URL string
+
+	// Client is the http.Client used to send the requests. Defaults to
+	// http.DefaultClient.
+	Client *http.Client
+
+	// Token is sent as a bearer token if set. See nfork.Auth.
+	Token string
+
+	// User and Password are sent using HTTP basic authentication if User is
+	// set. See nfork.Auth.
+	User     string
+	Password string
+}
+
+// List returns all the inbounds.
+func (client *Client) List() (result []*nfork.Inbound, err error) {
+	err = client.call("GET", nil, nil, &result)
+	return
+}
+
+// ListInbound returns the given inbound.
+func (client *Client) ListInbound(inbound string) (result *nfork.Inbound, err error) {
+	err = client.call("GET", []string{inbound}, nil, &result)
+	return
+}
+
+// AddInbound adds the given inbound.
+func (client *Client) AddInbound(inbound *nfork.Inbound) error {
+	return client.call("POST", nil, inbound, nil)
+}
+
+// RemoveInbound removes the given inbound.
+func (client *Client) RemoveInbound(inbound string) error {
+	return client.call("DELETE", []string{inbound}, nil, nil)
+}
+
+// AddOutbound adds or replaces an outbound of the given inbound.
+func (client *Client) AddOutbound(inbound, outbound, addr string) error {
+	return client.call("PUT", []string{inbound, outbound}, addr, nil)
+}
+
+// RemoveOutbound removes an outbound of the given inbound.
+func (client *Client) RemoveOutbound(inbound, outbound string) error {
+	return client.call("DELETE", []string{inbound, outbound}, nil, nil)
+}
+
+// ActivateOutbound activates the given outbound for the given inbound.
+func (client *Client) ActivateOutbound(inbound, outbound string) error {
+	return client.call("PUT", []string{inbound, outbound, "activate"}, nil, nil)
+}
+
+// ReadStats returns the stats of the last complete window of each inbound.
+func (client *Client) ReadStats() (result map[string]*nfork.InboundStats, err error) {
+	err = client.call("GET", []string{"stats"}, nil, &result)
+	return
+}
+
+// ReadStatsWindow returns the stats of the given window of each inbound.
+func (client *Client) ReadStatsWindow(window string) (result map[string]*nfork.InboundStats, err error) {
+	err = client.call("GET", []string{"stats", window}, nil, &result)
+	return
+}
+
+// ReadInboundStats returns the stats of the last complete window of the given
+// inbound.
+func (client *Client) ReadInboundStats(inbound string) (result *nfork.InboundStats, err error) {
+	err = client.call("GET", []string{inbound, "stats"}, nil, &result)
+	return
+}
+
+// ReadInboundStatsWindow returns the stats of the given window of the given
+// inbound.
+func (client *Client) ReadInboundStatsWindow(inbound, window string) (result *nfork.InboundStats, err error) {
+	err = client.call("GET", []string{inbound, "stats", window}, nil, &result)
+	return
+}
+
+// ReadOutboundStats returns the stats of the last complete window of the given
+// inbound's outbound.
+func (client *Client) ReadOutboundStats(inbound, outbound string) (result *nfork.Stats, err error) {
+	err = client.call("GET", []string{inbound, outbound, "stats"}, nil, &result)
+	return
+}
+
+// ReadOutboundStatsWindow returns the stats of the given window of the given
+// inbound's outbound.
+func (client *Client) ReadOutboundStatsWindow(inbound, outbound, window string) (result *nfork.Stats, err error) {
+	err = client.call("GET", []string{inbound, outbound, "stats", window}, nil, &result)
+	return
+}
+
+// ResetInboundStats resets the stats of the given inbound and of each of its
+// outbounds.
+func (client *Client) ResetInboundStats(inbound string) error {
+	return client.call("DELETE", []string{inbound, "stats"}, nil, nil)
+}
+
+// ResetOutboundStats resets the stats of the given inbound's outbound.
+func (client *Client) ResetOutboundStats(inbound, outbound string) error {
+	return client.call("DELETE", []string{inbound, outbound, "stats"}, nil, nil)
+}
+
+// ReadInboundCodes returns the confusion matrix of each shadow outbound of the
+// given inbound.
+func (client *Client) ReadInboundCodes(inbound string) (result map[string]nfork.CodeMatrix, err error) {
+	err = client.call("GET", []string{inbound, "codes"}, nil, &result)
+	return
+}
+
+// ReadOutboundCodes returns the confusion matrix of the given shadow outbound.
+func (client *Client) ReadOutboundCodes(inbound, outbound string) (result nfork.CodeMatrix, err error) {
+	err = client.call("GET", []string{inbound, outbound, "codes"}, nil, &result)
+	return
+}
+
+// ReadInboundHistory returns the stats history of the given inbound and of each
+// of its outbounds.
+func (client *Client) ReadInboundHistory(inbound string) (result *nfork.InboundHistory, err error) {
+	err = client.call("GET", []string{inbound, "history"}, nil, &result)
+	return
+}
+
+// ReadOutboundHistory returns the stats history of the given inbound's
+// outbound.
+func (client *Client) ReadOutboundHistory(inbound, outbound string) (result []*nfork.StatsSample, err error) {
+	err = client.call("GET", []string{inbound, outbound, "history"}, nil, &result)
+	return
+}
+
+// ReadOutboundErrors returns the last failed or slow requests of the given
+// inbound's outbound.
+func (client *Client) ReadOutboundErrors(inbound, outbound string) (result []*nfork.ErrorSample, err error) {
+	err = client.call("GET", []string{inbound, outbound, "errors"}, nil, &result)
+	return
+}
+
+// call sends a request to the REST route made of the given path segments and
+// decodes the JSON response in result if not nil.
+func (client *Client) call(method string, path []string, body, result interface{}) error {
+	base := client.URL
+	if len(base) == 0 {
+		base = DefaultURL
+	}
+
+	URL := strings.TrimSuffix(base, "/") + nfork.RESTPrefix
+	for _, segment := range path {
+		URL += "/" + url.PathEscape(segment)
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	httpReq, err := http.NewRequest(method, URL, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+
+	if len(client.Token) > 0 {
+		httpReq.Header.Set("Authorization", "Bearer "+client.Token)
+	} else if len(client.User) > 0 {
+		httpReq.SetBasicAuth(client.User, client.Password)
+	}
+
+	httpClient := client.Client
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &Error{Method: method, URL: URL, Code: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+	}
+
+	if result == nil || len(data) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(data, result); err != nil {
+		return fmt.Errorf("unable to parse response of %s %s: %s", method, URL, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,269 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package client
+
+import (
+	"github.com/datacratic/gonfork/nfork"
+	"github.com/datacratic/gorest/rest"
+
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RESTHandler serves the REST routes of a controller the same way the rest
+// package does: the path parameters are passed to the handler of the route
+// followed by the JSON body of the request if the handler takes one more
+// argument. The results are encoded in JSON and errors are returned as a 400.
+type RESTHandler struct {
+	T      *testing.T
+	Routes rest.Routes
+}
+
+func (handler *RESTHandler) ServeHTTP(writer http.ResponseWriter, httpReq *http.Request) {
+	var route *rest.Route
+	var params []string
+	literals := -1
+
+	// Routes with more literal segments take precedence such that
+	// /v1/nfork/stats isn't handled as /v1/nfork/:inbound.
+	for _, candidate := range handler.Routes {
+		if candidate.Method != httpReq.Method {
+			continue
+		}
+
+		if values, n, ok := matchPath(candidate.Path, httpReq.URL.Path); ok && n > literals {
+			route, params, literals = candidate, values, n
+		}
+	}
+
+	if route == nil {
+		handler.T.Errorf("FAIL: no route for %s %s", httpReq.Method, httpReq.URL.Path)
+		http.NotFound(writer, httpReq)
+		return
+	}
+
+	fn := reflect.ValueOf(route.Handler)
+	var args []reflect.Value
+	for _, param := range params {
+		args = append(args, reflect.ValueOf(param))
+	}
+
+	if fn.Type().NumIn() == len(args)+1 {
+		body := reflect.New(fn.Type().In(len(args)))
+		if err := json.NewDecoder(httpReq.Body).Decode(body.Interface()); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		args = append(args, body.Elem())
+	}
+
+	var result interface{}
+	for _, out := range fn.Call(args) {
+		if err, ok := out.Interface().(error); ok {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if out.Type() != reflect.TypeOf((*error)(nil)).Elem() {
+			result = out.Interface()
+		}
+	}
+
+	if result != nil {
+		json.NewEncoder(writer).Encode(result)
+	}
+}
+
+// matchPath returns the values of the parameters of the given route path
+// matched by the given path along with the number of literal segments.
+func matchPath(route, path string) (params []string, literals int, ok bool) {
+	routeSegments := strings.Split(route, "/")
+	pathSegments := strings.Split(path, "/")
+	if len(routeSegments) != len(pathSegments) {
+		return nil, 0, false
+	}
+
+	for i, segment := range routeSegments {
+		if strings.HasPrefix(segment, ":") {
+			params = append(params, pathSegments[i])
+		} else if segment == pathSegments[i] {
+			literals++
+		} else {
+			return nil, 0, false
+		}
+	}
+
+	return params, literals, true
+}
+
+// NewTestHandler returns a handler serving the REST routes of the given
+// controller wrapped by Controller.HTTPHandler as nforkd does.
+func NewTestHandler(t *testing.T, control *nfork.Controller) http.Handler {
+	return control.HTTPHandler(&RESTHandler{T: t, Routes: control.RESTRoutes()})
+}
+
+// AllocatePort returns an address of the loopback interface which is free.
+func AllocatePort(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("FAIL: unable to allocate port -> %s", err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func TestClient(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer backend.Close()
+
+	control := nfork.NewController(nil)
+	defer control.Close()
+
+	server := httptest.NewServer(NewTestHandler(t, control))
+	defer server.Close()
+
+	client := &Client{URL: server.URL}
+
+	inbound := &nfork.Inbound{
+		Name:         "i0",
+		Listen:       AllocatePort(t),
+		Outbound:     map[string]string{"s0": backend.URL},
+		Active:       "s0",
+		Timeout:      time.Second,
+		StatsWindows: []time.Duration{time.Minute},
+		ErrorSamples: 10,
+	}
+
+	if err := client.AddInbound(inbound); err != nil {
+		t.Fatalf("FAIL(add): unexpected error -> %s", err)
+	}
+
+	if err := client.AddOutbound("i0", "s1", backend.URL); err != nil {
+		t.Errorf("FAIL(add): unexpected error -> %s", err)
+	}
+
+	if err := client.ActivateOutbound("i0", "s1"); err != nil {
+		t.Errorf("FAIL(activate): unexpected error -> %s", err)
+	}
+
+	if inbounds, err := client.List(); err != nil {
+		t.Errorf("FAIL(list): unexpected error -> %s", err)
+	} else if len(inbounds) != 1 || inbounds[0].Name != "i0" {
+		t.Errorf("FAIL(list): unexpected inbounds -> %v", inbounds)
+	}
+
+	result, err := client.ListInbound("i0")
+	if err != nil {
+		t.Fatalf("FAIL(list): unexpected error -> %s", err)
+	}
+
+	body, _ := json.Marshal(result)
+	expBody, _ := json.Marshal(control.List()[0])
+	if string(body) != string(expBody) {
+		t.Errorf("FAIL(list): inbound doesn't round-trip -> %s != %s", body, expBody)
+	}
+	if result.Active != "s1" || result.Outbound["s1"] != backend.URL {
+		t.Errorf("FAIL(list): unexpected inbound -> %+v", result)
+	}
+
+	if _, err := client.ListInbound("bob"); err == nil {
+		t.Errorf("FAIL(list): expected unknown inbound error")
+	} else if clientErr, ok := err.(*Error); !ok || clientErr.Message != "unknown inbound 'bob'" {
+		t.Errorf("FAIL(list): unexpected error -> %s", err)
+	}
+
+	resp, err := http.Get("http://" + inbound.Listen + "/a")
+	if err != nil {
+		t.Fatalf("FAIL(request): unexpected error -> %s", err)
+	}
+	resp.Body.Close()
+
+	if samples, err := client.ReadOutboundErrors("i0", "s1"); err != nil {
+		t.Errorf("FAIL(errors): unexpected error -> %s", err)
+	} else if len(samples) != 1 || samples[0].Path != "/a" || samples[0].Latency == 0 {
+		t.Errorf("FAIL(errors): unexpected samples -> %v", samples)
+	}
+
+	if stats, err := client.ReadOutboundStats("i0", "s1"); err != nil {
+		t.Errorf("FAIL(stats): unexpected error -> %s", err)
+	} else if stats == nil {
+		t.Errorf("FAIL(stats): missing stats")
+	}
+
+	if stats, err := client.ReadStats(); err != nil {
+		t.Errorf("FAIL(stats): unexpected error -> %s", err)
+	} else if stats["i0"] == nil || stats["i0"].Outbounds["s1"] == nil {
+		t.Errorf("FAIL(stats): unexpected stats -> %v", stats)
+	}
+
+	if stats, err := client.ReadInboundStatsWindow("i0", nfork.TotalWindow); err != nil {
+		t.Errorf("FAIL(stats): unexpected error -> %s", err)
+	} else if stats.Inbound.Requests != 1 || stats.Outbounds["s1"].Latency.Count != 1 {
+		t.Errorf("FAIL(stats): unexpected total stats -> %+v", stats)
+	}
+
+	if err := client.ResetInboundStats("i0"); err != nil {
+		t.Errorf("FAIL(reset): unexpected error -> %s", err)
+	}
+
+	if stats, err := client.ReadOutboundStatsWindow("i0", "s1", nfork.TotalWindow); err != nil {
+		t.Errorf("FAIL(reset): unexpected error -> %s", err)
+	} else if stats.Requests != 0 {
+		t.Errorf("FAIL(reset): unexpected total stats -> %+v", stats)
+	}
+
+	if err := client.RemoveOutbound("i0", "s0"); err != nil {
+		t.Errorf("FAIL(remove): unexpected error -> %s", err)
+	}
+
+	if err := client.RemoveInbound("i0"); err != nil {
+		t.Errorf("FAIL(remove): unexpected error -> %s", err)
+	}
+
+	if inbounds, err := client.List(); err != nil || len(inbounds) != 0 {
+		t.Errorf("FAIL(remove): unexpected inbounds -> %v, %v", inbounds, err)
+	}
+}
+
+func TestClientAuth(t *testing.T) {
+	control := nfork.NewController(nil)
+	defer control.Close()
+
+	auth := &nfork.Auth{Credentials: []*nfork.Credential{
+		{Token: "t0", Role: nfork.RoleReader},
+		{User: "bob", Password: "secret", Role: nfork.RoleAdmin},
+	}}
+
+	server := httptest.NewServer(auth.Handler(NewTestHandler(t, control)))
+	defer server.Close()
+
+	ExpectCode := func(title string, err error, exp int) {
+		if clientErr, ok := err.(*Error); !ok || clientErr.Code != exp {
+			t.Errorf("FAIL(%s): unexpected error -> %v", title, err)
+		}
+	}
+
+	_, err := (&Client{URL: server.URL}).List()
+	ExpectCode("none", err, http.StatusUnauthorized)
+
+	reader := &Client{URL: server.URL, Token: "t0"}
+	if _, err := reader.List(); err != nil {
+		t.Errorf("FAIL(reader): unexpected error -> %s", err)
+	}
+	ExpectCode("reader", reader.RemoveInbound("i0"), http.StatusForbidden)
+
+	// The admin request reaches the controller which doesn't know the inbound.
+	admin := &Client{URL: server.URL, User: "bob", Password: "secret"}
+	if err := admin.RemoveInbound("i0"); err == nil {
+		t.Errorf("FAIL(admin): expected unknown inbound error")
+	} else if clientErr, ok := err.(*Error); !ok || !strings.Contains(clientErr.Message, "'i0'") {
+		t.Errorf("FAIL(admin): unexpected error -> %s", err)
+	}
+}
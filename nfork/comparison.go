@@ -0,0 +1,183 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package nfork
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DefaultSlowerThreshold is used if SlowerThreshold is not set in
+// StatsRecorder.
+const DefaultSlowerThreshold = 10 * time.Millisecond
+
+// Comparison compares the outcome of the requests to a shadow outbound with
+// the outcome of the same requests to the active outbound.
+type Comparison struct {
+
+	// Codes is a confusion matrix which counts the requests for each pair of
+	// outcomes: the outcome of the active outbound followed by the outcome of
+	// the shadow outbound. See Event.Outcome for the format of outcomes.
+	Codes CodeMatrix
+
+	// Requests counts the number of requests whose latency was compared. Only
+	// the requests for which both outbounds returned a response are compared.
+	Requests uint64
+
+	// Slower is the distribution of the latency difference for the requests
+	// where the shadow outbound was slower than the active outbound.
+	Slower Histogram
+
+	// Faster is the distribution of the latency difference for the requests
+	// where the shadow outbound was faster or as fast as the active outbound.
+	Faster Histogram
+
+	// Threshold is the latency difference above which a shadow outbound is
+	// considered slower than the active outbound.
+	Threshold time.Duration
+
+	// OverThreshold counts the number of requests where the shadow outbound
+	// was slower than the active outbound by more than Threshold.
+	OverThreshold uint64
+}
+
+// CodeMatrix counts pairs of request outcomes indexed by the outcome of the
+// active outbound and then by the outcome of the shadow outbound.
+type CodeMatrix map[string]map[string]uint64
+
+// Copy returns a deep copy of the matrix.
+func (matrix CodeMatrix) Copy() CodeMatrix {
+	newMatrix := make(CodeMatrix)
+	newMatrix.Merge(matrix)
+	return newMatrix
+}
+
+// Merge adds the counts of other to the matrix.
+func (matrix CodeMatrix) Merge(other CodeMatrix) {
+	for active, row := range other {
+		for shadow, count := range row {
+			matrix.add(active, shadow, count)
+		}
+	}
+}
+
+func (matrix CodeMatrix) add(active, shadow string, count uint64) {
+	row, ok := matrix[active]
+	if !ok {
+		row = make(map[string]uint64)
+		matrix[active] = row
+	}
+	row[shadow] += count
+}
+
+// Copy returns a deep copy of the comparison.
+func (comp *Comparison) Copy() *Comparison {
+	newComp := *comp
+	newComp.Codes = comp.Codes.Copy()
+	newComp.Slower = comp.Slower.Copy()
+	newComp.Faster = comp.Faster.Copy()
+	return &newComp
+}
+
+// Merge adds the requests compared in other to the comparison.
+func (comp *Comparison) Merge(other *Comparison) {
+	if comp.Codes == nil {
+		comp.Codes = make(CodeMatrix)
+	}
+	comp.Codes.Merge(other.Codes)
+
+	comp.Requests += other.Requests
+	comp.Slower.Merge(&other.Slower)
+	comp.Faster.Merge(&other.Faster)
+	comp.OverThreshold += other.OverThreshold
+
+	if comp.Threshold == 0 {
+		comp.Threshold = other.Threshold
+	}
+}
+
+func (comp *Comparison) record(active, shadow Event) {
+	if comp.Codes == nil {
+		comp.Codes = make(CodeMatrix)
+	}
+	comp.Codes.add(active.Outcome(), shadow.Outcome(), 1)
+
+	if active.Error || active.Timeout || shadow.Error || shadow.Timeout {
+		return
+	}
+
+	comp.Requests++
+
+	if shadow.Latency > active.Latency {
+		delta := shadow.Latency - active.Latency
+		comp.Slower.Sample(uint64(delta))
+
+		if delta > comp.Threshold {
+			comp.OverThreshold++
+		}
+
+	} else {
+		comp.Faster.Sample(uint64(active.Latency - shadow.Latency))
+	}
+}
+
+// MarshalJSON defines a custom JSON format for encoding/json.
+func (comp *Comparison) MarshalJSON() ([]byte, error) {
+	var compJSON struct {
+		Codes         CodeMatrix        `json:"codes"`
+		Requests      uint64            `json:"requests"`
+		Slower        map[string]string `json:"slower"`
+		Faster        map[string]string `json:"faster"`
+		Threshold     string            `json:"threshold"`
+		OverThreshold uint64            `json:"overThreshold"`
+		Ratio         float64           `json:"overThresholdRatio"`
+
+		Histograms struct {
+			Slower *Histogram `json:"slower"`
+			Faster *Histogram `json:"faster"`
+		} `json:"histograms"`
+	}
+
+	compJSON.Codes = comp.Codes
+	compJSON.Requests = comp.Requests
+	compJSON.Slower = latencyJSON(&comp.Slower)
+	compJSON.Faster = latencyJSON(&comp.Faster)
+	compJSON.Histograms.Slower = &comp.Slower
+	compJSON.Histograms.Faster = &comp.Faster
+	compJSON.Threshold = comp.Threshold.String()
+	compJSON.OverThreshold = comp.OverThreshold
+
+	if comp.Requests > 0 {
+		compJSON.Ratio = float64(comp.OverThreshold) / float64(comp.Requests)
+	}
+
+	return json.Marshal(&compJSON)
+}
+
+// UnmarshalJSON defines a custom JSON format for encoding/json.
+func (comp *Comparison) UnmarshalJSON(body []byte) (err error) {
+	var compJSON struct {
+		Codes         CodeMatrix `json:"codes"`
+		Requests      uint64     `json:"requests"`
+		Threshold     string     `json:"threshold"`
+		OverThreshold uint64     `json:"overThreshold"`
+
+		Histograms struct {
+			Slower Histogram `json:"slower"`
+			Faster Histogram `json:"faster"`
+		} `json:"histograms"`
+	}
+
+	if err = json.Unmarshal(body, &compJSON); err != nil {
+		return
+	}
+
+	comp.Codes = compJSON.Codes
+	comp.Requests = compJSON.Requests
+	comp.OverThreshold = compJSON.OverThreshold
+	comp.Slower = compJSON.Histograms.Slower
+	comp.Faster = compJSON.Histograms.Faster
+
+	comp.Threshold, err = time.ParseDuration(compJSON.Threshold)
+	return
+}
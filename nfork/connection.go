@@ -0,0 +1,247 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package nfork
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// ConnectionStats contains the connection timings of the requests made to an
+// outbound which are gathered using net/http/httptrace. Each timing is only
+// sampled for the requests where the corresponding step took place: DNS,
+// Connect and TLSHandshake are therefore only sampled for new connections.
+type ConnectionStats struct {
+
+	// Connections counts the number of requests which obtained a connection.
+	Connections uint64
+
+	// Reused counts the number of requests which reused an idle connection
+	// from the connection pool.
+	Reused uint64
+
+	// DNS is the distribution of the DNS lookup durations.
+	DNS Histogram
+
+	// Connect is the distribution of the durations required to establish new
+	// connections.
+	Connect Histogram
+
+	// TLSHandshake is the distribution of the TLS handshake durations.
+	TLSHandshake Histogram
+
+	// FirstByte is the distribution of the durations between the start of the
+	// request and the first byte of the response.
+	FirstByte Histogram
+}
+
+// ConnectionTrace contains the connection timings of a single request. Timings
+// are zero if the corresponding step didn't take place.
+type ConnectionTrace struct {
+
+	// Obtained indicates that a connection was obtained for the request.
+	Obtained bool
+
+	// Reused indicates that the connection was reused from the pool.
+	Reused bool
+
+	DNS          time.Duration
+	Connect      time.Duration
+	TLSHandshake time.Duration
+	FirstByte    time.Duration
+}
+
+// Copy returns a deep copy of the stats.
+func (conn *ConnectionStats) Copy() *ConnectionStats {
+	newConn := *conn
+	newConn.DNS = conn.DNS.Copy()
+	newConn.Connect = conn.Connect.Copy()
+	newConn.TLSHandshake = conn.TLSHandshake.Copy()
+	newConn.FirstByte = conn.FirstByte.Copy()
+	return &newConn
+}
+
+// Merge adds the stats of other to the stats.
+func (conn *ConnectionStats) Merge(other *ConnectionStats) {
+	conn.Connections += other.Connections
+	conn.Reused += other.Reused
+	conn.DNS.Merge(&other.DNS)
+	conn.Connect.Merge(&other.Connect)
+	conn.TLSHandshake.Merge(&other.TLSHandshake)
+	conn.FirstByte.Merge(&other.FirstByte)
+}
+
+// ReuseRatio returns the share of connections which were reused.
+func (conn *ConnectionStats) ReuseRatio() float64 {
+	if conn.Connections == 0 {
+		return 0
+	}
+	return float64(conn.Reused) / float64(conn.Connections)
+}
+
+func (conn *ConnectionStats) record(trace ConnectionTrace) {
+	conn.Connections++
+	if trace.Reused {
+		conn.Reused++
+	}
+
+	sample := func(hist *Histogram, value time.Duration) {
+		if value > 0 {
+			hist.Sample(uint64(value))
+		}
+	}
+
+	sample(&conn.DNS, trace.DNS)
+	sample(&conn.Connect, trace.Connect)
+	sample(&conn.TLSHandshake, trace.TLSHandshake)
+	sample(&conn.FirstByte, trace.FirstByte)
+}
+
+// MarshalJSON defines a custom JSON format for encoding/json.
+func (conn *ConnectionStats) MarshalJSON() ([]byte, error) {
+	var connJSON struct {
+		Connections  uint64            `json:"connections"`
+		Reused       uint64            `json:"reused"`
+		ReuseRatio   float64           `json:"reuseRatio"`
+		DNS          map[string]string `json:"dns"`
+		Connect      map[string]string `json:"connect"`
+		TLSHandshake map[string]string `json:"tlsHandshake"`
+		FirstByte    map[string]string `json:"firstByte"`
+
+		Histograms struct {
+			DNS          *Histogram `json:"dns"`
+			Connect      *Histogram `json:"connect"`
+			TLSHandshake *Histogram `json:"tlsHandshake"`
+			FirstByte    *Histogram `json:"firstByte"`
+		} `json:"histograms"`
+	}
+
+	connJSON.Connections = conn.Connections
+	connJSON.Reused = conn.Reused
+	connJSON.ReuseRatio = conn.ReuseRatio()
+	connJSON.DNS = latencyJSON(&conn.DNS)
+	connJSON.Connect = latencyJSON(&conn.Connect)
+	connJSON.TLSHandshake = latencyJSON(&conn.TLSHandshake)
+	connJSON.FirstByte = latencyJSON(&conn.FirstByte)
+
+	connJSON.Histograms.DNS = &conn.DNS
+	connJSON.Histograms.Connect = &conn.Connect
+	connJSON.Histograms.TLSHandshake = &conn.TLSHandshake
+	connJSON.Histograms.FirstByte = &conn.FirstByte
+
+	return json.Marshal(&connJSON)
+}
+
+// UnmarshalJSON defines a custom JSON format for encoding/json.
+func (conn *ConnectionStats) UnmarshalJSON(body []byte) (err error) {
+	var connJSON struct {
+		Connections uint64 `json:"connections"`
+		Reused      uint64 `json:"reused"`
+
+		Histograms struct {
+			DNS          Histogram `json:"dns"`
+			Connect      Histogram `json:"connect"`
+			TLSHandshake Histogram `json:"tlsHandshake"`
+			FirstByte    Histogram `json:"firstByte"`
+		} `json:"histograms"`
+	}
+
+	if err = json.Unmarshal(body, &connJSON); err != nil {
+		return
+	}
+
+	conn.Connections = connJSON.Connections
+	conn.Reused = connJSON.Reused
+	conn.DNS = connJSON.Histograms.DNS
+	conn.Connect = connJSON.Histograms.Connect
+	conn.TLSHandshake = connJSON.Histograms.TLSHandshake
+	conn.FirstByte = connJSON.Histograms.FirstByte
+	return
+}
+
+// connectionTracer gathers the connection timings of a single request. The
+// httptrace hooks can be called from multiple goroutines and even after the
+// request completed so the trace is protected by a mutex.
+type connectionTracer struct {
+	t0 time.Time
+
+	mutex                            sync.Mutex
+	dnsStart, connectStart, tlsStart time.Time
+	trace                            ConnectionTrace
+}
+
+func newConnectionTracer(t0 time.Time) *connectionTracer {
+	return &connectionTracer{t0: t0}
+}
+
+func (tracer *connectionTracer) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			tracer.mutex.Lock()
+			tracer.trace.Obtained = true
+			tracer.trace.Reused = info.Reused
+			tracer.mutex.Unlock()
+		},
+
+		DNSStart: func(httptrace.DNSStartInfo) {
+			tracer.mutex.Lock()
+			tracer.dnsStart = time.Now()
+			tracer.mutex.Unlock()
+		},
+
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			tracer.mutex.Lock()
+			if info.Err == nil && !tracer.dnsStart.IsZero() {
+				tracer.trace.DNS = time.Since(tracer.dnsStart)
+			}
+			tracer.mutex.Unlock()
+		},
+
+		// Multiple addresses may be dialed in parallel for a single
+		// connection so only the first attempt to succeed is kept.
+		ConnectStart: func(network, addr string) {
+			tracer.mutex.Lock()
+			if tracer.connectStart.IsZero() {
+				tracer.connectStart = time.Now()
+			}
+			tracer.mutex.Unlock()
+		},
+
+		ConnectDone: func(network, addr string, err error) {
+			tracer.mutex.Lock()
+			if err == nil && tracer.trace.Connect == 0 {
+				tracer.trace.Connect = time.Since(tracer.connectStart)
+			}
+			tracer.mutex.Unlock()
+		},
+
+		TLSHandshakeStart: func() {
+			tracer.mutex.Lock()
+			tracer.tlsStart = time.Now()
+			tracer.mutex.Unlock()
+		},
+
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			tracer.mutex.Lock()
+			if err == nil && !tracer.tlsStart.IsZero() {
+				tracer.trace.TLSHandshake = time.Since(tracer.tlsStart)
+			}
+			tracer.mutex.Unlock()
+		},
+
+		GotFirstResponseByte: func() {
+			tracer.mutex.Lock()
+			tracer.trace.FirstByte = time.Since(tracer.t0)
+			tracer.mutex.Unlock()
+		},
+	}
+}
+
+func (tracer *connectionTracer) read() ConnectionTrace {
+	tracer.mutex.Lock()
+	defer tracer.mutex.Unlock()
+	return tracer.trace
+}
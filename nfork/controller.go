@@ -6,11 +6,21 @@ import (
 	"github.com/datacratic/goklog/klog"
 	"github.com/datacratic/gorest/rest"
 
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 )
 
+// RESTPrefix is the path prefix of all the routes defined by a Controller.
+const RESTPrefix = "/v1/nfork"
+
 // Controller manages a set of Inbound objects wrapped in InboundServer objects
 // and defines a REST interface to do so.
 type Controller struct {
@@ -18,8 +28,21 @@ type Controller struct {
 	// Inbounds is the initial list of Inbounds.
 	Inbounds []*Inbound
 
+	// StateFile is an optional file where the current list of inbounds is
+	// written after every successful modification. If the file exists when the
+	// controller is started, its content replaces Inbounds.
+	StateFile string
+
+	// Publisher is set on all the inbounds which don't already have one.
+	Publisher StatsPublisher
+
+	// Tracer is set on all the inbounds which don't already have one.
+	Tracer SpanExporter
+
 	mutex    sync.Mutex
 	inbounds map[string]*InboundServer
+
+	stream *statsStream
 }
 
 // NewController returns a new Controller object initialized with the given
@@ -32,31 +55,92 @@ func NewController(inbounds []*Inbound) *Controller {
 
 // RESTRoutes defines the REST inteface for a Controller.
 func (control *Controller) RESTRoutes() rest.Routes {
-	prefix := "/v1/nfork"
+	prefix := RESTPrefix
 	return rest.Routes{
 		rest.NewRoute(prefix, "GET", control.List),
 		rest.NewRoute(prefix, "POST", control.AddInbound),
 		rest.NewRoute(prefix+"/stats", "GET", control.ReadStats),
+		rest.NewRoute(prefix+"/stats/:window", "GET", control.ReadStatsWindow),
 
 		rest.NewRoute(prefix+"/:inbound", "GET", control.ListInbound),
 		rest.NewRoute(prefix+"/:inbound", "DELETE", control.RemoveInbound),
 		rest.NewRoute(prefix+"/:inbound/stats", "GET", control.ReadInboundStats),
+		rest.NewRoute(prefix+"/:inbound/stats", "DELETE", control.ResetInboundStats),
+		rest.NewRoute(prefix+"/:inbound/stats/:window", "GET", control.ReadInboundStatsWindow),
+		rest.NewRoute(prefix+"/:inbound/codes", "GET", control.ReadInboundCodes),
+		rest.NewRoute(prefix+"/:inbound/history", "GET", control.ReadInboundHistory),
 
 		rest.NewRoute(prefix+"/:inbound/:outbound", "PUT", control.AddOutbound),
 		rest.NewRoute(prefix+"/:inbound/:outbound", "DELETE", control.RemoveOutbound),
+		rest.NewRoute(prefix+"/:inbound/:outbound/activate", "PUT", control.ActivateOutbound),
 		rest.NewRoute(prefix+"/:inbound/:outbound/stats", "GET", control.ReadOutboundStats),
+		rest.NewRoute(prefix+"/:inbound/:outbound/stats", "DELETE", control.ResetOutboundStats),
+		rest.NewRoute(prefix+"/:inbound/:outbound/stats/:window", "GET", control.ReadOutboundStatsWindow),
+		rest.NewRoute(prefix+"/:inbound/:outbound/codes", "GET", control.ReadOutboundCodes),
+		rest.NewRoute(prefix+"/:inbound/:outbound/history", "GET", control.ReadOutboundHistory),
+		rest.NewRoute(prefix+"/:inbound/:outbound/errors", "GET", control.ReadOutboundErrors),
 	}
 }
 
+// HTTPHandler wraps the given handler, typically the one serving the REST
+// routes, to serve the routes which can't be expressed as REST routes: the
+// stats streams (GET /v1/nfork/stats/stream and /v1/nfork/:inbound/stats/stream),
+// the taps (GET /v1/nfork/:inbound/tap) and the window query parameter of the
+// stats routes (see StatsWindowHandler).
+func (control *Controller) HTTPHandler(handler http.Handler) http.Handler {
+	handler = StatsWindowHandler(handler)
+
+	return http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		if inbound, ok := parseStreamPath(httpReq.URL.Path); ok && httpReq.Method == "GET" {
+			control.ServeStream(writer, httpReq, inbound)
+			return
+		}
+
+		if inbound, ok := parseTapPath(httpReq.URL.Path); ok && httpReq.Method == "GET" {
+			control.ServeTap(writer, httpReq, inbound)
+			return
+		}
+
+		handler.ServeHTTP(writer, httpReq)
+	})
+}
+
+// StatsWindowHandler wraps the given handler such that the window query
+// parameter of the stats REST routes is translated into the window path
+// parameter (eg. /v1/nfork/stats?window=1m becomes /v1/nfork/stats/1m). This
+// is required because the REST routes can only bind path parameters.
+func StatsWindowHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		path := httpReq.URL.Path
+		query := httpReq.URL.Query()
+
+		window := query.Get("window")
+		if len(window) > 0 && strings.HasPrefix(path, RESTPrefix+"/") && strings.HasSuffix(path, "/stats") {
+			query.Del("window")
+			httpReq.URL.Path = path + "/" + window
+			httpReq.URL.RawPath = ""
+			httpReq.URL.RawQuery = query.Encode()
+		}
+
+		handler.ServeHTTP(writer, httpReq)
+	})
+}
+
 // Start initializes and starts the server associated with the configured
-// inbounds.
+// inbounds. If StateFile exists, the inbounds are first restored from it.
 func (control *Controller) Start() {
 	control.inbounds = make(map[string]*InboundServer)
+	control.stream = newStatsStream(control)
+
+	if err := control.restore(); err != nil {
+		log.Fatalf("unable to restore state from '%s': %s", control.StateFile, err)
+	}
 
 	for i, inbound := range control.Inbounds {
 		if inbound == nil {
 			log.Fatalf("nil inbound at index %d", i)
 		}
+		control.prepare(inbound)
 
 		server, err := NewInboundServer(inbound)
 		if err != nil {
@@ -67,12 +151,17 @@ func (control *Controller) Start() {
 	}
 }
 
-// Close closes the managed inbound servers.
+// Close closes the managed inbound servers. It can be called more than once
+// and on a controller which was never started.
 func (control *Controller) Close() {
 	for _, server := range control.inbounds {
 		server.Close()
 	}
 	control.inbounds = nil
+
+	if control.stream != nil {
+		control.stream.close()
+	}
 }
 
 // List returns the Inbound object associated with each inbounds.
@@ -101,11 +190,11 @@ func (control *Controller) ListInbound(inbound string) (*Inbound, error) {
 }
 
 // ReadStats returns the stats associated with each inbounds.
-func (control *Controller) ReadStats() map[string]map[string]*Stats {
+func (control *Controller) ReadStats() map[string]*InboundStats {
 	control.mutex.Lock()
 	defer control.mutex.Unlock()
 
-	stats := make(map[string]map[string]*Stats)
+	stats := make(map[string]*InboundStats)
 	for inbound, server := range control.inbounds {
 		stats[inbound] = server.ReadStats()
 	}
@@ -113,8 +202,144 @@ func (control *Controller) ReadStats() map[string]map[string]*Stats {
 	return stats
 }
 
+// ReadStatsWindow returns the stats of the given window associated with each
+// inbounds.
+func (control *Controller) ReadStatsWindow(window string) (map[string]*InboundStats, error) {
+	control.mutex.Lock()
+	defer control.mutex.Unlock()
+
+	stats := make(map[string]*InboundStats)
+	for inbound, server := range control.inbounds {
+		var err error
+		if stats[inbound], err = server.ReadStatsWindow(window); err != nil {
+			return nil, err
+		}
+	}
+
+	return stats, nil
+}
+
+// ReadInboundStatsWindow returns the stats of the given window associated with
+// the given inbound.
+func (control *Controller) ReadInboundStatsWindow(inbound, window string) (*InboundStats, error) {
+	control.mutex.Lock()
+	defer control.mutex.Unlock()
+
+	server, ok := control.inbounds[inbound]
+	if !ok {
+		return nil, fmt.Errorf("unknown inbound '%s'", inbound)
+	}
+
+	return server.ReadStatsWindow(window)
+}
+
+// ReadOutboundStatsWindow returns the stats of the given window associated with
+// the given inbound's outbound.
+func (control *Controller) ReadOutboundStatsWindow(inbound, outbound, window string) (*Stats, error) {
+	control.mutex.Lock()
+	defer control.mutex.Unlock()
+
+	server, ok := control.inbounds[inbound]
+	if !ok {
+		return nil, fmt.Errorf("unknown inbound '%s'", inbound)
+	}
+
+	return server.ReadOutboundStatsWindow(outbound, window)
+}
+
+// ReadInboundCodes returns, for each shadow outbound of the given inbound, the
+// confusion matrix of its outcomes against the outcomes of the active outbound
+// accumulated since the creation of the outbound.
+func (control *Controller) ReadInboundCodes(inbound string) (map[string]CodeMatrix, error) {
+	stats, err := control.ReadInboundStatsWindow(inbound, TotalWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make(map[string]CodeMatrix)
+	for outbound, outStats := range stats.Outbounds {
+		if outStats.Comparison != nil {
+			codes[outbound] = outStats.Comparison.Codes
+		}
+	}
+
+	return codes, nil
+}
+
+// ReadOutboundCodes returns the confusion matrix of the outcomes of the given
+// shadow outbound against the outcomes of the active outbound accumulated since
+// the creation of the outbound.
+func (control *Controller) ReadOutboundCodes(inbound, outbound string) (CodeMatrix, error) {
+	stats, err := control.ReadOutboundStatsWindow(inbound, outbound, TotalWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	if stats.Comparison == nil {
+		return make(CodeMatrix), nil
+	}
+
+	return stats.Comparison.Codes, nil
+}
+
+// ReadInboundHistory returns the stats history of the given inbound and of each
+// of its outbounds.
+func (control *Controller) ReadInboundHistory(inbound string) (*InboundHistory, error) {
+	control.mutex.Lock()
+	defer control.mutex.Unlock()
+
+	server, ok := control.inbounds[inbound]
+	if !ok {
+		return nil, fmt.Errorf("unknown inbound '%s'", inbound)
+	}
+
+	return server.ReadHistory(), nil
+}
+
+// ReadOutboundHistory returns the stats history of the given inbound's
+// outbound.
+func (control *Controller) ReadOutboundHistory(inbound, outbound string) ([]*StatsSample, error) {
+	control.mutex.Lock()
+	defer control.mutex.Unlock()
+
+	server, ok := control.inbounds[inbound]
+	if !ok {
+		return nil, fmt.Errorf("unknown inbound '%s'", inbound)
+	}
+
+	return server.ReadOutboundHistory(outbound)
+}
+
+// ReadOutboundErrors returns the last failed or slow requests of the given
+// inbound's outbound.
+func (control *Controller) ReadOutboundErrors(inbound, outbound string) ([]*ErrorSample, error) {
+	control.mutex.Lock()
+	defer control.mutex.Unlock()
+
+	server, ok := control.inbounds[inbound]
+	if !ok {
+		return nil, fmt.Errorf("unknown inbound '%s'", inbound)
+	}
+
+	return server.ReadOutboundErrors(outbound)
+}
+
+// ReadTotalStats returns the stats accumulated since the creation of each
+// inbounds.
+func (control *Controller) ReadTotalStats() map[string]*InboundStats {
+	control.mutex.Lock()
+	defer control.mutex.Unlock()
+
+	stats := make(map[string]*InboundStats)
+	for inbound, server := range control.inbounds {
+		stats[inbound] = server.ReadTotalStats()
+	}
+
+	return stats
+}
+
 // ReadInboundStats returns the stats associated with the given inbound.
-func (control *Controller) ReadInboundStats(inbound string) (map[string]*Stats, error) {
+func (control *Controller) ReadInboundStats(inbound string) (*InboundStats, error) {
 	control.mutex.Lock()
 	defer control.mutex.Unlock()
 
@@ -140,6 +365,40 @@ func (control *Controller) ReadOutboundStats(inbound, outbound string) (*Stats,
 	return server.ReadOutboundStats(outbound)
 }
 
+// ResetInboundStats resets the stats of the given inbound and of each of its
+// outbounds.
+func (control *Controller) ResetInboundStats(inbound string) error {
+	control.mutex.Lock()
+	defer control.mutex.Unlock()
+
+	server, ok := control.inbounds[inbound]
+	if !ok {
+		return fmt.Errorf("unknown inbound '%s'", inbound)
+	}
+
+	server.ResetStats()
+	klog.KPrintf("controller.info", "ResetInboundStats(%s)", inbound)
+	return nil
+}
+
+// ResetOutboundStats resets the stats of the given inbound's outbound.
+func (control *Controller) ResetOutboundStats(inbound, outbound string) error {
+	control.mutex.Lock()
+	defer control.mutex.Unlock()
+
+	server, ok := control.inbounds[inbound]
+	if !ok {
+		return fmt.Errorf("unknown inbound '%s'", inbound)
+	}
+
+	if err := server.ResetOutboundStats(outbound); err != nil {
+		return err
+	}
+
+	klog.KPrintf("controller.info", "ResetOutboundStats(%s, %s)", inbound, outbound)
+	return nil
+}
+
 // AddInbound creates a new InboundServer for the given inbound and launches it.
 func (control *Controller) AddInbound(inbound *Inbound) error {
 	control.mutex.Lock()
@@ -148,6 +407,7 @@ func (control *Controller) AddInbound(inbound *Inbound) error {
 	if _, ok := control.inbounds[inbound.Name]; ok {
 		return fmt.Errorf("inbound '%s' already exists", inbound.Name)
 	}
+	control.prepare(inbound)
 
 	server, err := NewInboundServer(inbound)
 	if err != nil {
@@ -156,6 +416,7 @@ func (control *Controller) AddInbound(inbound *Inbound) error {
 
 	klog.KPrintf("controller.info", "AddInbound(%s, %s)", inbound.Name, inbound.Listen)
 	control.inbounds[inbound.Name] = server
+	control.persist()
 
 	return nil
 }
@@ -174,6 +435,7 @@ func (control *Controller) RemoveInbound(inbound string) error {
 
 	server.Close()
 	delete(control.inbounds, inbound)
+	control.persist()
 
 	return nil
 }
@@ -189,7 +451,12 @@ func (control *Controller) AddOutbound(inbound, outbound, addr string) error {
 	}
 
 	klog.KPrintf("controller.info", "AddOutbound(%s, %s, %s)", inbound, outbound, addr)
-	return server.AddOutbound(outbound, addr)
+	if err := server.AddOutbound(outbound, addr); err != nil {
+		return err
+	}
+
+	control.persist()
+	return nil
 }
 
 // RemoveOutbound removes the given outbound for the given inbound.
@@ -203,7 +470,12 @@ func (control *Controller) RemoveOutbound(inbound, outbound string) error {
 	}
 
 	klog.KPrintf("controller.info", "RemoveOutbound(%s, %s)", inbound, outbound)
-	return server.RemoveOutbound(outbound)
+	if err := server.RemoveOutbound(outbound); err != nil {
+		return err
+	}
+
+	control.persist()
+	return nil
 }
 
 // ActivateOutbound activates the given outbound for the given inbound.
@@ -217,5 +489,98 @@ func (control *Controller) ActivateOutbound(inbound, outbound string) error {
 	}
 
 	klog.KPrintf("controller.info", "ActivateOutbound(%s, %s)", inbound, outbound)
-	return server.ActivateOutbound(outbound)
+	if err := server.ActivateOutbound(outbound); err != nil {
+		return err
+	}
+
+	control.persist()
+	return nil
+}
+
+func (control *Controller) prepare(inbound *Inbound) {
+	if inbound.Publisher == nil {
+		inbound.Publisher = control.Publisher
+	}
+	if inbound.Tracer == nil {
+		inbound.Tracer = control.Tracer
+	}
+	inbound.notify = control.stream.notify
+}
+
+func (control *Controller) restore() error {
+	if len(control.StateFile) == 0 {
+		return nil
+	}
+
+	body, err := ioutil.ReadFile(control.StateFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var inbounds []*Inbound
+	if err := json.Unmarshal(body, &inbounds); err != nil {
+		return err
+	}
+
+	klog.KPrintf("controller.info", "restored %d inbounds from '%s'", len(inbounds), control.StateFile)
+	control.Inbounds = inbounds
+	return nil
+}
+
+// persist atomically writes the current list of inbounds to StateFile by
+// writing to a temporary file in the same directory and renaming it over the
+// old state. Failures are logged but not reported to the caller since the
+// modification has already been applied.
+func (control *Controller) persist() {
+	if len(control.StateFile) == 0 {
+		return
+	}
+
+	var inbounds []*Inbound
+	for _, server := range control.inbounds {
+		inbounds = append(inbounds, server.List())
+	}
+	sort.Sort(inboundArray(inbounds))
+
+	if err := writeFileAtomic(control.StateFile, inbounds); err != nil {
+		klog.KPrintf("controller.persist.error", "unable to write state to '%s': %s", control.StateFile, err)
+	}
+}
+
+func writeFileAtomic(path string, obj interface{}) error {
+	body, err := json.MarshalIndent(obj, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+
+	if err = file.Chmod(0644); err == nil {
+		_, err = file.Write(append(body, '\n'))
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
 }
+
+type inboundArray []*Inbound
+
+func (array inboundArray) Len() int           { return len(array) }
+func (array inboundArray) Swap(i, j int)      { array[i], array[j] = array[j], array[i] }
+func (array inboundArray) Less(i, j int) bool { return array[i].Name < array[j].Name }
@@ -3,8 +3,13 @@
 package nfork
 
 import (
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
 	"time"
 )
@@ -62,6 +67,11 @@ func TestController(t *testing.T) {
 	s1.Expect("{GET /a r2}", "{GET /b r2}", "{GET /c r2}")
 	s2.Expect("{GET /b r2}", "{GET /c r2}")
 
+	if stats := control.ReadTotalStats()["i2"].Inbound; stats.Failures != 1 || stats.BodyErrors != 0 ||
+		stats.Timeouts != 0 || stats.Responses[http.StatusServiceUnavailable] != 1 {
+		t.Errorf("FAIL(stats): unexpected i2 inbound stats -> %+v", stats)
+	}
+
 	ExpectRemoveIn(t, control, "i2")
 	ExpectInbound(t, i0URL, "GET", "a", "r3", http.StatusOK, "s0")
 	ExpectInbound(t, i1URL, "GET", "b", "r3", http.StatusCreated, "s1")
@@ -70,6 +80,80 @@ func TestController(t *testing.T) {
 	s2.Expect("{GET /b r3}")
 }
 
+func TestControllerState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nfork")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s0 := &TestService{T: t, Name: "s0"}
+	server0 := httptest.NewServer(s0)
+	defer server0.Close()
+
+	s1 := &TestService{T: t, Name: "s1", Code: http.StatusCreated}
+	server1 := httptest.NewServer(s1)
+	defer server1.Close()
+
+	i0, i0URL := NewInbound("i0", "s0", map[string]string{"s0": server0.URL})
+
+	state := filepath.Join(dir, "state.json")
+	control := &Controller{StateFile: state}
+	control.Start()
+
+	ExpectAddIn(t, control, i0)
+	if err := control.AddOutbound("i0", "s1", server1.URL); err != nil {
+		t.Errorf("FAIL(outbound.add): unable to add 's1' -> %s", err)
+	}
+	if err := control.ActivateOutbound("i0", "s1"); err != nil {
+		t.Errorf("FAIL(outbound.activate): unable to activate 's1' -> %s", err)
+	}
+	control.Close()
+
+	control = &Controller{StateFile: state}
+	control.Start()
+	defer control.Close()
+
+	inbound, err := control.ListInbound("i0")
+	if err != nil {
+		t.Fatalf("FAIL(state.restore): missing inbound 'i0' -> %s", err)
+	}
+	if inbound.Active != "s1" || len(inbound.Outbound) != 2 {
+		t.Errorf("FAIL(state.restore): unexpected inbound -> %v", inbound)
+	}
+
+	ExpectInbound(t, i0URL, "GET", "a", "r0", http.StatusCreated, "s1")
+	s0.Expect("{GET /a r0}")
+	s1.Expect("{GET /a r0}")
+}
+
+func TestControllerClose(t *testing.T) {
+	n := runtime.NumGoroutine()
+
+	i0, _ := NewInbound("i0", "s0", map[string]string{"s0": "http://localhost:1"})
+	i1, _ := NewInbound("i1", "s0", map[string]string{"s0": "http://localhost:1"})
+
+	control := NewController([]*Inbound{i0})
+
+	ExpectAddIn(t, control, i1)
+
+	for i := 0; i < 5; i++ {
+		if err := control.AddOutbound("i0", "s1", fmt.Sprintf("http://localhost:%d", i+2)); err != nil {
+			t.Fatalf("FAIL(add): unexpected error -> %s", err)
+		}
+		control.ReadStats()
+	}
+
+	if err := control.RemoveOutbound("i0", "s1"); err != nil {
+		t.Fatalf("FAIL(remove): unexpected error -> %s", err)
+	}
+
+	ExpectRemoveIn(t, control, "i1")
+
+	control.Close()
+	ExpectGoroutines(t, "close", n)
+}
+
 func NewInbound(name, active string, out map[string]string) (*Inbound, string) {
 	listen, URL := AllocatePort()
 	return &Inbound{
@@ -0,0 +1,269 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package nfork
+
+import (
+	"net/http"
+	"strings"
+)
+
+// DashboardPath is the path where nforkd serves the dashboard.
+const DashboardPath = "/dashboard"
+
+// ServeDashboard is an HTTP handler which serves a self-contained HTML page
+// showing the inbounds, their outbounds and their live stats. The page relies
+// on the REST routes and on the stats stream to display and modify the
+// inbounds so it must be served by the same server as HTTPHandler.
+func (control *Controller) ServeDashboard(writer http.ResponseWriter, httpReq *http.Request) {
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Write([]byte(dashboardPage))
+}
+
+var dashboardPage = strings.Replace(dashboardHTML, "{{prefix}}", RESTPrefix, -1)
+
+const dashboardHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>nfork</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.4em; }
+h2 { font-size: 1.1em; margin-bottom: 0.2em; }
+.inbound { border: 1px solid #ccc; border-radius: 4px; padding: 0.5em 1em 1em; margin-bottom: 1.5em; }
+.summary { color: #666; font-size: 0.9em; margin-bottom: 0.8em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 0.3em 0.8em; border-bottom: 1px solid #eee; }
+td.num, th.num { text-align: right; font-family: monospace; }
+tr.active { background: #eef7ee; }
+.role { font-size: 0.8em; padding: 0.1em 0.4em; border-radius: 3px; background: #ddd; }
+tr.active .role { background: #5a5; color: #fff; }
+.bad { color: #c22; font-weight: bold; }
+button { margin-right: 0.3em; }
+form { margin-top: 0.8em; }
+#error { display: none; background: #fdd; border: 1px solid #c22; padding: 0.5em 1em; margin-bottom: 1em; }
+#status { color: #666; font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>nfork</h1>
+<div id="status">connecting...</div>
+<div id="error"></div>
+<div id="inbounds"></div>
+<script>
+(function() {
+	var prefix = "{{prefix}}";
+	var inbounds = [];
+	var stats = {};
+
+	function escape(value) {
+		return String(value).replace(/[&<>"']/g, function(c) {
+			return {"&": "&amp;", "<": "&lt;", ">": "&gt;", '"': "&quot;", "'": "&#39;"}[c];
+		});
+	}
+
+	function path() {
+		var segments = [prefix];
+		for (var i = 0; i < arguments.length; i++) {
+			segments.push(encodeURIComponent(arguments[i]));
+		}
+		return segments.join("/");
+	}
+
+	function showError(message) {
+		var div = document.getElementById("error");
+		div.textContent = message;
+		div.style.display = message ? "block" : "none";
+	}
+
+	function call(method, url, body) {
+		var xhr = new XMLHttpRequest();
+		xhr.open(method, url);
+		xhr.onload = function() {
+			if (xhr.status < 200 || xhr.status >= 300) {
+				showError(method + " " + url + ": " + xhr.status + " " + xhr.responseText);
+			} else {
+				showError("");
+			}
+			load();
+		};
+		xhr.onerror = function() { showError(method + " " + url + ": request failed"); };
+		if (body !== undefined) {
+			xhr.setRequestHeader("Content-Type", "application/json");
+			xhr.send(JSON.stringify(body));
+		} else {
+			xhr.send();
+		}
+	}
+
+	function load() {
+		var xhr = new XMLHttpRequest();
+		xhr.open("GET", prefix);
+		xhr.onload = function() {
+			if (xhr.status !== 200) {
+				showError("GET " + prefix + ": " + xhr.status + " " + xhr.responseText);
+				return;
+			}
+			inbounds = JSON.parse(xhr.responseText) || [];
+			inbounds.sort(function(a, b) { return a.name < b.name ? -1 : a.name > b.name ? 1 : 0; });
+			render();
+		};
+		xhr.send();
+	}
+
+	function errorRate(s) {
+		if (!s || !s.requests) {
+			return 0;
+		}
+		var failed = s.errors + s.timeouts;
+		for (var code in s.responses) {
+			if (code >= 500) {
+				failed += s.responses[code];
+			}
+		}
+		return failed / s.requests;
+	}
+
+	function percent(ratio) {
+		return (ratio * 100).toFixed(2) + "%";
+	}
+
+	function summary(name) {
+		var current = stats[name];
+		if (!current) {
+			return "";
+		}
+		return " &middot; " + current.inbound.requests + " req/s &middot; " +
+			current.inFlight + " in flight &middot; " +
+			percent(errorRate(current.inbound)) + " failed";
+	}
+
+	// The page is only rebuilt when the inbounds change so that the stats
+	// updates don't reset the add forms.
+	function render() {
+		var html = "";
+
+		inbounds.forEach(function(inbound) {
+			var outbounds = Object.keys(inbound.out).sort();
+			var name = ' data-inbound="' + escape(inbound.name) + '"';
+
+			html += '<div class="inbound"><h2>' + escape(inbound.name) + '</h2>';
+			html += '<div class="summary">listening on ' + escape(inbound.listen) +
+				'<span class="live"' + name + '></span></div>';
+
+			html += '<table><tr><th>Outbound</th><th>Address</th><th>Role</th>' +
+				'<th class="num">req/s</th><th class="num">errors</th>' +
+				'<th class="num">p50</th><th class="num">p99</th><th></th></tr>';
+
+			outbounds.forEach(function(outbound) {
+				var active = outbound === inbound.active;
+				var data = name + ' data-outbound="' + escape(outbound) + '"';
+
+				html += '<tr' + data + (active ? ' class="active"' : '') + '>' +
+					'<td>' + escape(outbound) + '</td>' +
+					'<td>' + escape(inbound.out[outbound]) + '</td>' +
+					'<td><span class="role">' + (active ? 'active' : 'shadow') + '</span></td>' +
+					'<td class="num">-</td><td class="num">-</td><td class="num">-</td><td class="num">-</td>' +
+					'<td>' +
+					(active ? '' : '<button data-action="activate"' + data + '>Activate</button>') +
+					(active ? '' : '<button data-action="remove"' + data + '>Remove</button>') +
+					'</td></tr>';
+			});
+
+			html += '</table>';
+			html += '<form' + name + '>' +
+				'<input name="outbound" placeholder="name" required> ' +
+				'<input name="addr" placeholder="http://host:port" size="30" required> ' +
+				'<button type="submit">Add outbound</button></form>';
+			html += '</div>';
+		});
+
+		if (!inbounds.length) {
+			html = "<p>No inbounds.</p>";
+		}
+
+		document.getElementById("inbounds").innerHTML = html;
+		update();
+	}
+
+	function update() {
+		var i, spans = document.querySelectorAll("span.live");
+		for (i = 0; i < spans.length; i++) {
+			spans[i].innerHTML = summary(spans[i].getAttribute("data-inbound"));
+		}
+
+		var rows = document.querySelectorAll("tr[data-outbound]");
+		for (i = 0; i < rows.length; i++) {
+			var current = stats[rows[i].getAttribute("data-inbound")];
+			var s = current && current.outbounds[rows[i].getAttribute("data-outbound")];
+			var cells = rows[i].querySelectorAll("td.num");
+			if (!s) {
+				continue;
+			}
+
+			var rate = errorRate(s);
+			cells[0].textContent = s.requests;
+			cells[1].textContent = percent(rate);
+			cells[1].className = rate > 0 ? "num bad" : "num";
+			cells[2].textContent = s.latency.p50;
+			cells[3].textContent = s.latency.p99;
+		}
+	}
+
+	document.addEventListener("click", function(e) {
+		var target = e.target;
+		var action = target.getAttribute("data-action");
+		if (!action) {
+			return;
+		}
+
+		var inbound = target.getAttribute("data-inbound");
+		var outbound = target.getAttribute("data-outbound");
+
+		if (action === "activate") {
+			if (confirm("Activate " + outbound + " on " + inbound + "?\n\nIts responses will be sent back to the clients.")) {
+				call("PUT", path(inbound, outbound, "activate"));
+			}
+		} else if (action === "remove") {
+			if (confirm("Remove " + outbound + " from " + inbound + "?")) {
+				call("DELETE", path(inbound, outbound));
+			}
+		}
+	});
+
+	document.addEventListener("submit", function(e) {
+		e.preventDefault();
+		var form = e.target;
+		var inbound = form.getAttribute("data-inbound");
+		var outbound = form.elements.outbound.value;
+		var addr = form.elements.addr.value;
+
+		if (confirm("Add " + outbound + " (" + addr + ") to " + inbound + "?")) {
+			call("PUT", path(inbound, outbound), addr);
+		}
+	});
+
+	var status = document.getElementById("status");
+	var stream = new EventSource(prefix + "/stats/stream");
+
+	stream.onopen = function() { status.textContent = "live"; };
+	stream.onerror = function() { status.textContent = "disconnected, reconnecting..."; };
+	stream.onmessage = function(e) {
+		var event = JSON.parse(e.data);
+		stats[event.inbound] = event.stats;
+
+		var known = inbounds.some(function(inbound) { return inbound.name === event.inbound; });
+		if (known) {
+			update();
+		} else {
+			load();
+		}
+	};
+
+	load();
+})();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,46 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package nfork
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestControllerDashboard(t *testing.T) {
+	control := NewController(nil)
+	defer control.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(control.ServeDashboard))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + DashboardPath)
+	if err != nil {
+		t.Fatalf("FAIL: unexpected error -> %s", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("FAIL: unable to read body -> %s", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("FAIL: unexpected status -> %d", resp.StatusCode)
+	}
+
+	if exp := "text/html"; !strings.HasPrefix(resp.Header.Get("Content-Type"), exp) {
+		t.Errorf("FAIL: unexpected content type -> %s", resp.Header.Get("Content-Type"))
+	}
+
+	page := string(body)
+	if !strings.Contains(page, `var prefix = "`+RESTPrefix+`";`) {
+		t.Errorf("FAIL: REST prefix not set in dashboard")
+	}
+	if strings.Contains(page, "{{") {
+		t.Errorf("FAIL: unexpanded placeholder in dashboard")
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package nfork
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// HistogramBits is the number of significant bits of a value kept by a
+// Histogram. Values are bucketed with a relative error of at most
+// 1/2^(HistogramBits-1).
+const HistogramBits = 6
+
+const (
+	histogramSubBuckets = 1 << HistogramBits
+	histogramHalf       = histogramSubBuckets / 2
+)
+
+// Histogram collects a set of values into log-linear buckets to calculate
+// percentiles with a bounded relative error: each power of two is divided into
+// a fixed number of linear buckets. Recording a value is constant time and two
+// histograms can be merged without any loss of precision.
+type Histogram struct {
+
+	// Counts holds the number of values that fell in each bucket. It grows
+	// lazily up to the bucket of the largest value sampled.
+	Counts []uint64
+
+	// Count is the number of values sampled.
+	Count uint64
+
+	// Sum is the sum of all the values sampled.
+	Sum uint64
+
+	// Min is the smallest value sampled.
+	Min uint64
+
+	// Max is the largest value sampled.
+	Max uint64
+}
+
+func histogramIndex(value uint64) int {
+	if value < histogramSubBuckets {
+		return int(value)
+	}
+
+	shift := uint(bits.Len64(value) - HistogramBits)
+	return histogramSubBuckets + int(shift-1)*histogramHalf + int(value>>shift) - histogramHalf
+}
+
+func histogramLowerBound(index int) uint64 {
+	if index < histogramSubBuckets {
+		return uint64(index)
+	}
+
+	index -= histogramSubBuckets
+	shift := uint(index/histogramHalf + 1)
+	return uint64(index%histogramHalf+histogramHalf) << shift
+}
+
+func histogramUpperBound(index int) uint64 {
+	return histogramLowerBound(index+1) - 1
+}
+
+// Copy returns a deep copy of the histogram.
+func (hist *Histogram) Copy() Histogram {
+	newHist := *hist
+	if hist.Counts != nil {
+		newHist.Counts = make([]uint64, len(hist.Counts))
+		copy(newHist.Counts, hist.Counts)
+	}
+	return newHist
+}
+
+// Sample adds a new value to the histogram.
+func (hist *Histogram) Sample(value uint64) {
+	index := histogramIndex(value)
+	if index >= len(hist.Counts) {
+		hist.grow(index + 1)
+	}
+	hist.Counts[index]++
+
+	if hist.Count == 0 || value < hist.Min {
+		hist.Min = value
+	}
+	if value > hist.Max {
+		hist.Max = value
+	}
+
+	hist.Count++
+	hist.Sum += value
+}
+
+// Merge adds all the values sampled by other to the histogram.
+func (hist *Histogram) Merge(other *Histogram) {
+	if other.Count == 0 {
+		return
+	}
+
+	if len(other.Counts) > len(hist.Counts) {
+		hist.grow(len(other.Counts))
+	}
+	for i, count := range other.Counts {
+		hist.Counts[i] += count
+	}
+
+	if hist.Count == 0 || other.Min < hist.Min {
+		hist.Min = other.Min
+	}
+	if other.Max > hist.Max {
+		hist.Max = other.Max
+	}
+
+	hist.Count += other.Count
+	hist.Sum += other.Sum
+}
+
+func (hist *Histogram) grow(n int) {
+	counts := make([]uint64, n)
+	copy(counts, hist.Counts)
+	hist.Counts = counts
+}
+
+// Percentile returns the approximated value below which the given percentage
+// of the values fall. The percentage must be between 0 and 100.
+func (hist *Histogram) Percentile(p float64) uint64 {
+	if hist.Count == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(p / 100 * float64(hist.Count)))
+	if rank == 0 {
+		return hist.Min
+	}
+
+	var sum uint64
+	for i, count := range hist.Counts {
+		if sum += count; sum < rank {
+			continue
+		}
+
+		value := histogramUpperBound(i)
+		if value > hist.Max {
+			value = hist.Max
+		}
+		if value < hist.Min {
+			value = hist.Min
+		}
+		return value
+	}
+
+	return hist.Max
+}
+
+// Percentiles returns the approximated 50th, 90th and 99th percentile as well
+// as the maximum value seen.
+func (hist *Histogram) Percentiles() (p50, p90, p99, max uint64) {
+	return hist.Percentile(50), hist.Percentile(90), hist.Percentile(99), hist.Max
+}
+
+// Mean returns the average of all the values sampled.
+func (hist *Histogram) Mean() uint64 {
+	if hist.Count == 0 {
+		return 0
+	}
+	return hist.Sum / hist.Count
+}
+
+// CountBelow returns the approximated number of values that are lower or equal
+// to the given value. The approximation is limited to the bucket containing
+// the value.
+func (hist *Histogram) CountBelow(value uint64) (count uint64) {
+	last := histogramIndex(value)
+
+	for i := 0; i <= last && i < len(hist.Counts); i++ {
+		count += hist.Counts[i]
+	}
+
+	return
+}
+
+// MarshalJSON defines a custom JSON format for encoding/json. Only the
+// non-empty buckets are kept, each as a pair made of the lower bound of the
+// bucket and of its count, such that the histogram can be decoded without any
+// loss of precision.
+func (hist *Histogram) MarshalJSON() ([]byte, error) {
+	var histJSON struct {
+		Count   uint64      `json:"count"`
+		Sum     uint64      `json:"sum"`
+		Min     uint64      `json:"min"`
+		Max     uint64      `json:"max"`
+		Buckets [][2]uint64 `json:"buckets,omitempty"`
+	}
+
+	histJSON.Count = hist.Count
+	histJSON.Sum = hist.Sum
+	histJSON.Min = hist.Min
+	histJSON.Max = hist.Max
+
+	for i, count := range hist.Counts {
+		if count > 0 {
+			histJSON.Buckets = append(histJSON.Buckets, [2]uint64{histogramLowerBound(i), count})
+		}
+	}
+
+	return json.Marshal(&histJSON)
+}
+
+// UnmarshalJSON defines a custom JSON format for encoding/json.
+func (hist *Histogram) UnmarshalJSON(body []byte) error {
+	var histJSON struct {
+		Count   uint64      `json:"count"`
+		Sum     uint64      `json:"sum"`
+		Min     uint64      `json:"min"`
+		Max     uint64      `json:"max"`
+		Buckets [][2]uint64 `json:"buckets"`
+	}
+
+	if err := json.Unmarshal(body, &histJSON); err != nil {
+		return err
+	}
+
+	*hist = Histogram{Count: histJSON.Count, Sum: histJSON.Sum, Min: histJSON.Min, Max: histJSON.Max}
+
+	var count uint64
+	for _, bucket := range histJSON.Buckets {
+		index := histogramIndex(bucket[0])
+		if histogramLowerBound(index) != bucket[0] {
+			return fmt.Errorf("invalid histogram bucket '%d'", bucket[0])
+		}
+
+		if index >= len(hist.Counts) {
+			hist.grow(index + 1)
+		}
+		hist.Counts[index] += bucket[1]
+		count += bucket[1]
+	}
+
+	if count != hist.Count {
+		return fmt.Errorf("histogram count %d doesn't match its buckets %d", hist.Count, count)
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package nfork
+
+import (
+	"testing"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	for value := uint64(0); value < 1<<16; value++ {
+		i := histogramIndex(value)
+		if low, high := histogramLowerBound(i), histogramUpperBound(i); value < low || value > high {
+			t.Fatalf("FAIL(%d): value outside of bucket %d -> [%d, %d]", value, i, low, high)
+		}
+	}
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	var a, b Histogram
+	for i := uint64(1); i <= 10000; i++ {
+		if i%2 == 0 {
+			a.Sample(i * 1000)
+		} else {
+			b.Sample(i * 1000)
+		}
+	}
+
+	a.Merge(&b)
+
+	if a.Count != 10000 || a.Min != 1000 || a.Max != 10000000 {
+		t.Errorf("FAIL: unexpected merge -> count=%d min=%d max=%d", a.Count, a.Min, a.Max)
+	}
+
+	ExpectPercentile := func(p float64, exp uint64) {
+		value := a.Percentile(p)
+		if value < exp || float64(value-exp) > float64(exp)/(histogramHalf) {
+			t.Errorf("FAIL(p%g): unexpected percentile -> %d != %d", p, value, exp)
+		}
+	}
+
+	ExpectPercentile(0, 1000)
+	ExpectPercentile(50, 5000000)
+	ExpectPercentile(90, 9000000)
+	ExpectPercentile(99.9, 9990000)
+	ExpectPercentile(100, 10000000)
+
+	if count := a.CountBelow(5000000); count < 5000 || count > 5000+5000/histogramHalf {
+		t.Errorf("FAIL: unexpected count below -> %d", count)
+	}
+}
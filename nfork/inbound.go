@@ -6,15 +6,18 @@ import (
 	"github.com/datacratic/goklog/klog"
 
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -60,9 +63,72 @@ type Inbound struct {
 	// overwrite the transport of the Client if it is set.
 	IdleConnections int
 
+	// Routes is an ordered list of route patterns used to group the stats of
+	// each outbound by request path. Requests which don't match any of the
+	// routes are grouped under OtherRoute. See RouteTable for the format of
+	// the patterns.
+	Routes []string
+
+	// SlowerThreshold is the latency difference above which a shadow outbound
+	// is considered slower than the active outbound for the same request.
+	// Defaults to DefaultSlowerThreshold.
+	SlowerThreshold time.Duration
+
+	// StatsWindows are the additional periods over which the stats of each
+	// outbound are aggregated. Defaults to DefaultStatsWindows.
+	StatsWindows []time.Duration
+
+	// StatsHistory is the number of past 1 second windows kept for the inbound
+	// and each of its outbounds. Defaults to DefaultStatsHistory.
+	StatsHistory int
+
+	// ErrorSamples is the number of failed or slow requests kept for each
+	// outbound. Defaults to DefaultErrorSamples.
+	ErrorSamples int
+
+	// SlowRequest is the latency above which a successful request is kept
+	// along with the failed requests. Defaults to half of Timeout.
+	SlowRequest time.Duration
+
+	// RequestIDHeader is the optional name of the header carrying the ID of
+	// each request. The ID of an incoming request is reused if present,
+	// otherwise a new one is generated. The ID is forwarded to all the
+	// outbounds, sent back to the client and written in the access log and in
+	// the logs of failed requests.
+	RequestIDHeader string
+
+	// AccessLog is an optional file where a record of each request is appended
+	// or AccessLogStdout to write the records to stdout.
+	AccessLog string
+
+	// AccessLogFormat is either AccessLogCommon or AccessLogJSON. Defaults to
+	// AccessLogCommon.
+	AccessLogFormat string
+
+	// Publisher is notified of the stats of the inbound and of each outbound
+	// every time they are updated.
+	Publisher StatsPublisher
+
+	// Tracer is an optional exporter notified of the spans of each request.
+	// If set, the W3C trace context of each request is propagated to each
+	// outbound with a new child span. Requests without a trace context start a
+	// new trace.
+	Tracer SpanExporter
+
 	initialize sync.Once
 
-	stats map[string]*StatsRecorder
+	routes  *RouteTable
+	stats   map[string]*StatsRecorder
+	samples map[string]*ErrorRing
+
+	inboundStats *StatsRecorder
+	inFlight     *int64
+	accessLog    *AccessLog
+	taps         *tapHub
+
+	// notify is called with the name of the inbound every time its stats are
+	// updated.
+	notify func(string)
 }
 
 // Copy returns a copy of the inbound object.
@@ -77,9 +143,28 @@ func (inbound *Inbound) Copy() *Inbound {
 		Timeout:         inbound.Timeout,
 		TimeoutCode:     inbound.TimeoutCode,
 		IdleConnections: inbound.IdleConnections,
-
-		Client: inbound.Client,
-		stats:  make(map[string]*StatsRecorder),
+		StatsWindows:    inbound.StatsWindows,
+		StatsHistory:    inbound.StatsHistory,
+		Routes:          inbound.Routes,
+		SlowerThreshold: inbound.SlowerThreshold,
+		ErrorSamples:    inbound.ErrorSamples,
+		SlowRequest:     inbound.SlowRequest,
+		RequestIDHeader: inbound.RequestIDHeader,
+		AccessLog:       inbound.AccessLog,
+		AccessLogFormat: inbound.AccessLogFormat,
+
+		Client:    inbound.Client,
+		Publisher: inbound.Publisher,
+		Tracer:    inbound.Tracer,
+		routes:    inbound.routes,
+		stats:     make(map[string]*StatsRecorder),
+		samples:   make(map[string]*ErrorRing),
+
+		inboundStats: inbound.inboundStats,
+		inFlight:     inbound.inFlight,
+		accessLog:    inbound.accessLog,
+		taps:         inbound.taps,
+		notify:       inbound.notify,
 	}
 
 	for outbound, addr := range inbound.Outbound {
@@ -90,6 +175,10 @@ func (inbound *Inbound) Copy() *Inbound {
 		newInbound.stats[outbound] = stats
 	}
 
+	for outbound, ring := range inbound.samples {
+		newInbound.samples[outbound] = ring
+	}
+
 	return newInbound
 }
 
@@ -115,6 +204,17 @@ func (inbound *Inbound) Validate() error {
 		return fmt.Errorf("active outbound '%s' doesn't exist in '%s'", inbound.Active, inbound.Name)
 	}
 
+	if _, err := NewRouteTable(inbound.Routes); err != nil {
+		return fmt.Errorf("invalid routes in '%s': %s", inbound.Name, err)
+	}
+
+	if len(inbound.AccessLog) > 0 {
+		accessLog := &AccessLog{Path: inbound.AccessLog, Format: inbound.AccessLogFormat}
+		if err := accessLog.Validate(); err != nil {
+			return fmt.Errorf("invalid access log in '%s': %s", inbound.Name, err)
+		}
+	}
+
 	return nil
 }
 
@@ -147,23 +247,80 @@ func (inbound *Inbound) init() {
 		inbound.Client.Timeout = inbound.Timeout
 	}
 
+	var err error
+	if inbound.routes, err = NewRouteTable(inbound.Routes); err != nil {
+		log.Panicf("invalid routes in '%s': %s", inbound.Name, err)
+	}
+
 	if inbound.stats == nil {
 		inbound.stats = make(map[string]*StatsRecorder)
 	}
 
+	if inbound.samples == nil {
+		inbound.samples = make(map[string]*ErrorRing)
+	}
+
+	if inbound.inboundStats == nil {
+		inbound.inboundStats = &StatsRecorder{
+			Windows: inbound.StatsWindows,
+			History: inbound.StatsHistory,
+		}
+
+		publisher, notify, name := inbound.Publisher, inbound.notify, inbound.Name
+		if publisher != nil || notify != nil {
+			inbound.inboundStats.Publish = func(stats *Stats) {
+				if publisher != nil {
+					publisher.PublishStats(name, "", stats)
+				}
+				if notify != nil {
+					notify(name)
+				}
+			}
+		}
+	}
+
+	if inbound.inFlight == nil {
+		inbound.inFlight = new(int64)
+	}
+
+	if inbound.taps == nil {
+		inbound.taps = new(tapHub)
+	}
+
+	if inbound.accessLog == nil && len(inbound.AccessLog) > 0 {
+		inbound.accessLog = &AccessLog{Path: inbound.AccessLog, Format: inbound.AccessLogFormat}
+	}
+
 	for outbound := range inbound.Outbound {
-		inbound.stats[outbound] = new(StatsRecorder)
+		if _, ok := inbound.stats[outbound]; !ok {
+			inbound.stats[outbound] = inbound.newRecorder(outbound)
+		}
+
+		if _, ok := inbound.samples[outbound]; !ok {
+			inbound.samples[outbound] = &ErrorRing{Size: inbound.ErrorSamples}
+		}
 	}
 }
 
-// ReadStats returns the stats associated with each outbounds.
-func (inbound *Inbound) ReadStats() map[string]*Stats {
-	stats := make(map[string]*Stats)
+func (inbound *Inbound) newRecorder(outbound string) *StatsRecorder {
+	recorder := &StatsRecorder{
+		Windows:         inbound.StatsWindows,
+		History:         inbound.StatsHistory,
+		SlowerThreshold: inbound.SlowerThreshold,
+	}
 
-	for outbound, recorder := range inbound.stats {
-		stats[outbound] = recorder.Read()
+	if publisher, name := inbound.Publisher, inbound.Name; publisher != nil {
+		recorder.Publish = func(stats *Stats) {
+			publisher.PublishStats(name, outbound, stats)
+		}
 	}
 
+	return recorder
+}
+
+// ReadStats returns the stats of the inbound and of each of its outbounds.
+func (inbound *Inbound) ReadStats() *InboundStats {
+	stats, _ := inbound.ReadStatsWindow("")
 	return stats
 }
 
@@ -176,11 +333,119 @@ func (inbound *Inbound) ReadOutboundStats(outbound string) (*Stats, error) {
 	return inbound.stats[outbound].Read(), nil
 }
 
+// ReadStatsWindow returns the stats of the given window of the inbound and of
+// each of its outbounds. See StatsRecorder.ReadWindow for the format of the
+// window.
+func (inbound *Inbound) ReadStatsWindow(window string) (*InboundStats, error) {
+	inbound.Init()
+
+	stats := &InboundStats{
+		InFlight:  atomic.LoadInt64(inbound.inFlight),
+		Outbounds: make(map[string]*Stats),
+	}
+
+	var err error
+	if stats.Inbound, err = inbound.inboundStats.ReadWindow(window); err != nil {
+		return nil, err
+	}
+
+	for outbound, recorder := range inbound.stats {
+		if stats.Outbounds[outbound], err = recorder.ReadWindow(window); err != nil {
+			return nil, err
+		}
+	}
+
+	return stats, nil
+}
+
+// ReadOutboundStatsWindow returns the stats of the given window associated with
+// a given outbound.
+func (inbound *Inbound) ReadOutboundStatsWindow(outbound, window string) (*Stats, error) {
+	if _, ok := inbound.Outbound[outbound]; !ok {
+		return nil, fmt.Errorf("unknown outbound '%s' for inbound '%s'", outbound, inbound.Name)
+	}
+
+	return inbound.stats[outbound].ReadWindow(window)
+}
+
+// ReadTotalStats returns the stats accumulated since the creation of the
+// inbound and of each of its outbounds.
+func (inbound *Inbound) ReadTotalStats() *InboundStats {
+	stats, _ := inbound.ReadStatsWindow(TotalWindow)
+	return stats
+}
+
+// ReadHistory returns the stats history of the inbound and of each of its
+// outbounds.
+func (inbound *Inbound) ReadHistory() *InboundHistory {
+	inbound.Init()
+
+	history := &InboundHistory{
+		Inbound:   inbound.inboundStats.ReadHistory(),
+		Outbounds: make(map[string][]*StatsSample),
+	}
+
+	for outbound, recorder := range inbound.stats {
+		history.Outbounds[outbound] = recorder.ReadHistory()
+	}
+
+	return history
+}
+
+// ReadOutboundHistory returns the stats history associated with a given
+// outbound.
+func (inbound *Inbound) ReadOutboundHistory(outbound string) ([]*StatsSample, error) {
+	if _, ok := inbound.Outbound[outbound]; !ok {
+		return nil, fmt.Errorf("unknown outbound '%s' for inbound '%s'", outbound, inbound.Name)
+	}
+
+	return inbound.stats[outbound].ReadHistory(), nil
+}
+
+// ReadOutboundErrors returns the last failed or slow requests associated with
+// a given outbound ordered from the oldest to the most recent.
+func (inbound *Inbound) ReadOutboundErrors(outbound string) ([]*ErrorSample, error) {
+	if _, ok := inbound.Outbound[outbound]; !ok {
+		return nil, fmt.Errorf("unknown outbound '%s' for inbound '%s'", outbound, inbound.Name)
+	}
+
+	return inbound.samples[outbound].Read(), nil
+}
+
+// ResetStats resets the stats of the inbound and of each of its outbounds.
+func (inbound *Inbound) ResetStats() {
+	inbound.Init()
+
+	inbound.inboundStats.Reset()
+	for _, recorder := range inbound.stats {
+		recorder.Reset()
+	}
+}
+
+// ResetOutboundStats resets the stats associated with a given outbound.
+func (inbound *Inbound) ResetOutboundStats(outbound string) error {
+	if _, ok := inbound.Outbound[outbound]; !ok {
+		return fmt.Errorf("unknown outbound '%s' for inbound '%s'", outbound, inbound.Name)
+	}
+
+	inbound.stats[outbound].Reset()
+	return nil
+}
+
 // AddOutbound adds a new outbound associated with the given address. If the
-// outbound already exists, it is overridden.
+// outbound already exists, it is overridden and its stats recorder is closed.
+//
+// Stats recorders are shared between an inbound and its copies so the stats
+// recorders of the outbounds which are overridden or removed should no longer
+// be used by any copy after the call.
 func (inbound *Inbound) AddOutbound(outbound, addr string) error {
+	if recorder, ok := inbound.stats[outbound]; ok {
+		recorder.Close()
+	}
+
 	inbound.Outbound[outbound] = addr
-	inbound.stats[outbound] = new(StatsRecorder)
+	inbound.stats[outbound] = inbound.newRecorder(outbound)
+	inbound.samples[outbound] = &ErrorRing{Size: inbound.ErrorSamples}
 	return nil
 }
 
@@ -195,8 +460,13 @@ func (inbound *Inbound) RemoveOutbound(outbound string) error {
 		return fmt.Errorf("can't remove active outbound '%s' for inbound '%s'", outbound, inbound.Name)
 	}
 
+	if recorder, ok := inbound.stats[outbound]; ok {
+		recorder.Close()
+	}
+
 	delete(inbound.Outbound, outbound)
 	delete(inbound.stats, outbound)
+	delete(inbound.samples, outbound)
 
 	return nil
 }
@@ -212,25 +482,107 @@ func (inbound *Inbound) ActivateOutbound(outbound string) error {
 	return nil
 }
 
+// Close closes the stats recorders of the inbound and of each of its outbounds
+// along with the access log and the taps. Since these are shared between an
+// inbound and its copies, Close should only be called once the inbound and all
+// its copies are no longer used.
+func (inbound *Inbound) Close() {
+	if inbound.accessLog != nil {
+		inbound.accessLog.Close()
+	}
+
+	if inbound.taps != nil {
+		inbound.taps.close()
+	}
+
+	if inbound.inboundStats != nil {
+		inbound.inboundStats.Close()
+	}
+
+	for _, recorder := range inbound.stats {
+		recorder.Close()
+	}
+}
+
 // ServeHTTP forwards the given HTTP request to all the outbounds and forwards
 // the response of the active outbound back upstream. All other responses are
 // dropped.
 func (inbound *Inbound) ServeHTTP(writer http.ResponseWriter, httpReq *http.Request) {
 	inbound.Init()
 
+	t0 := time.Now()
+	event := Event{Route: inbound.routes.Match(httpReq.URL.Path)}
+
+	requestID := inbound.requestID(httpReq)
+	if len(requestID) > 0 {
+		writer.Header().Set(inbound.RequestIDHeader, requestID)
+	}
+
+	var span *Span
+	if inbound.Tracer != nil {
+		span = inbound.startSpan(httpReq, requestID, t0)
+	}
+
+	var status int
+	var forked bool
+	var recordC chan *AccessRecord
+	if inbound.accessLog != nil || inbound.taps.isActive() {
+		recordC = make(chan *AccessRecord, 1)
+	}
+
+	atomic.AddInt64(inbound.inFlight, 1)
+	defer func() {
+		atomic.AddInt64(inbound.inFlight, -1)
+		event.Latency = time.Since(t0)
+		inbound.inboundStats.Record(event)
+
+		if span != nil {
+			inbound.finishSpan(span, event)
+		}
+
+		if recordC == nil {
+			return
+		}
+
+		record := &AccessRecord{
+			Time:       t0,
+			RemoteAddr: httpReq.RemoteAddr,
+			Method:     httpReq.Method,
+			Path:       httpReq.URL.RequestURI(),
+			Proto:      httpReq.Proto,
+			RequestID:  requestID,
+			Status:     status,
+			Event:      event,
+			Active:     inbound.Active,
+		}
+
+		// The record is completed with the outcome of each outbound once they
+		// are all known.
+		if forked {
+			recordC <- record
+		} else {
+			inbound.logAccess(record)
+		}
+	}()
+
 	body, err := ioutil.ReadAll(httpReq.Body)
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusBadRequest)
+		event.BodyError = true
+		status = http.StatusBadRequest
+		event.Response = status
+		http.Error(writer, err.Error(), status)
 		return
 	}
+	event.RequestBytes = len(body)
 
 	httpReq.Header.Set("X-Nfork", "true")
 
 	var activeHost string
+	shadowC := make(chan shadowEvent, len(inbound.Outbound))
 
 	for outbound, host := range inbound.Outbound {
 		if outbound != inbound.Active {
-			go inbound.forward(outbound, httpReq, host, body)
+			go inbound.shadow(outbound, httpReq, host, body, span, shadowC)
 		} else {
 			activeHost = host
 		}
@@ -240,12 +592,22 @@ func (inbound *Inbound) ServeHTTP(writer http.ResponseWriter, httpReq *http.Requ
 		log.Panicf("no active outbound '%s'", inbound.Active)
 	}
 
-	respHead, respBody, err := inbound.forward(inbound.Active, httpReq, activeHost, body)
+	respHead, respBody, activeEvent, err := inbound.forward(inbound.Active, httpReq, activeHost, body, span)
+	go inbound.compare(activeEvent, len(inbound.Outbound)-1, shadowC, recordC)
+	forked = true
+
 	if err != nil {
-		http.Error(writer, err.Error(), inbound.TimeoutCode)
+		event.Failed = true
+		status = inbound.TimeoutCode
+		event.Response = status
+		http.Error(writer, err.Error(), status)
 		return
 	}
 
+	status = respHead.StatusCode
+	event.Response = respHead.StatusCode
+	event.ResponseBytes = len(respBody)
+
 	writerHeader := writer.Header()
 	for key, val := range respHead.Header {
 		writerHeader[key] = val
@@ -255,6 +617,58 @@ func (inbound *Inbound) ServeHTTP(writer http.ResponseWriter, httpReq *http.Requ
 	writer.Write(respBody)
 }
 
+type shadowEvent struct {
+	outbound string
+	event    Event
+}
+
+func (inbound *Inbound) shadow(
+	outbound string, oldReq *http.Request, addr string, body []byte, span *Span, shadowC chan shadowEvent) {
+
+	// Shadow requests must outlive the upstream request which is cancelled as
+	// soon as the response of the active outbound is sent back.
+	oldReq = oldReq.WithContext(context.Background())
+
+	_, _, event, _ := inbound.forward(outbound, oldReq, addr, body, span)
+	shadowC <- shadowEvent{outbound, event}
+}
+
+// compare waits for the outcome of each shadow outbound and records how they
+// compare to the outcome of the active outbound. If the inbound has an access
+// log or taps, the record received on recordC is then completed and logged.
+func (inbound *Inbound) compare(
+	active Event, shadows int, shadowC chan shadowEvent, recordC chan *AccessRecord) {
+
+	var outcomes map[string]Event
+	if recordC != nil {
+		outcomes = map[string]Event{inbound.Active: active}
+	}
+
+	for i := 0; i < shadows; i++ {
+		shadow := <-shadowC
+		inbound.stats[shadow.outbound].RecordComparison(active, shadow.event)
+
+		if outcomes != nil {
+			outcomes[shadow.outbound] = shadow.event
+		}
+	}
+
+	if recordC == nil {
+		return
+	}
+
+	record := <-recordC
+	record.Outbounds = outcomes
+	inbound.logAccess(record)
+}
+
+func (inbound *Inbound) logAccess(record *AccessRecord) {
+	if inbound.accessLog != nil {
+		inbound.accessLog.Write(record)
+	}
+	inbound.taps.publish(record)
+}
+
 func (inbound *Inbound) record(outbound string, event Event) {
 	stats, ok := inbound.stats[outbound]
 	if !ok {
@@ -263,6 +677,59 @@ func (inbound *Inbound) record(outbound string, event Event) {
 	stats.Record(event)
 }
 
+// requestID returns the ID of the given request if RequestIDHeader is set. A new
+// ID is generated and added to the request if it doesn't already have one.
+func (inbound *Inbound) requestID(httpReq *http.Request) string {
+	if len(inbound.RequestIDHeader) == 0 {
+		return ""
+	}
+
+	requestID := httpReq.Header.Get(inbound.RequestIDHeader)
+	if len(requestID) == 0 {
+		requestID = NewRequestID()
+		httpReq.Header.Set(inbound.RequestIDHeader, requestID)
+	}
+
+	return requestID
+}
+
+// NewRequestID returns a new random request ID.
+func NewRequestID() string {
+	return randomID(16)
+}
+
+// sample keeps the given request if it failed or was slow.
+func (inbound *Inbound) sample(outbound string, httpReq *http.Request, t0 time.Time, event Event, err error) {
+	slow := inbound.SlowRequest
+	if slow == 0 {
+		slow = inbound.Timeout / 2
+	}
+
+	category := sampleCategory(event, slow)
+	if len(category) == 0 {
+		return
+	}
+
+	sample := &ErrorSample{
+		Time:     t0,
+		Method:   httpReq.Method,
+		Path:     httpReq.URL.RequestURI(),
+		Category: category,
+		Response: event.Response,
+		Latency:  event.Latency,
+	}
+
+	if err != nil {
+		sample.Error = err.Error()
+	}
+
+	if len(inbound.RequestIDHeader) > 0 {
+		sample.RequestID = httpReq.Header.Get(inbound.RequestIDHeader)
+	}
+
+	inbound.samples[outbound].Add(sample)
+}
+
 func (inbound *Inbound) parseAddr(addr string) (host, scheme string) {
 	if i := strings.Index(addr, "://"); i >= 0 {
 		return addr[i+3:], addr[:i]
@@ -271,9 +738,10 @@ func (inbound *Inbound) parseAddr(addr string) (host, scheme string) {
 }
 
 func (inbound *Inbound) forward(
-	outbound string, oldReq *http.Request, addr string, body []byte) (*http.Response, []byte, error) {
+	outbound string, oldReq *http.Request, addr string, body []byte, parent *Span) (*http.Response, []byte, Event, error) {
 
 	t0 := time.Now()
+	event := Event{Route: inbound.routes.Match(oldReq.URL.Path), RequestBytes: len(body)}
 
 	host, scheme := inbound.parseAddr(addr)
 
@@ -289,34 +757,56 @@ func (inbound *Inbound) forward(
 	newReq.RequestURI = ""
 	newReq.Body = ioutil.NopCloser(bytes.NewReader(body))
 
+	if parent != nil {
+		span := inbound.startOutboundSpan(parent, outbound, newReq, t0)
+		defer func() { inbound.finishSpan(span, event) }()
+	}
+
+	tracer := newConnectionTracer(t0)
+	newReq = newReq.WithContext(httptrace.WithClientTrace(newReq.Context(), tracer.clientTrace()))
+
 	resp, err := inbound.Client.Do(newReq)
+	event.Connection = tracer.read()
 	if err != nil {
-		return nil, nil, inbound.error("send", outbound, err, t0)
+		err = inbound.error("send", outbound, oldReq, err, t0, &event)
+		inbound.sample(outbound, oldReq, t0, event, err)
+		return nil, nil, event, err
 	}
 
 	respBody, err := ioutil.ReadAll(resp.Body)
 	resp.Body.Close()
 	if err != nil {
-		return nil, nil, inbound.error("recv", outbound, err, t0)
+		err = inbound.error("recv", outbound, oldReq, err, t0, &event)
+		inbound.sample(outbound, oldReq, t0, event, err)
+		return nil, nil, event, err
 	}
 
-	inbound.record(outbound, Event{Response: resp.StatusCode, Latency: time.Since(t0)})
-	return resp, respBody, nil
+	event.Response = resp.StatusCode
+	event.Latency = time.Since(t0)
+	event.ResponseBytes = len(respBody)
+	inbound.record(outbound, event)
+	inbound.sample(outbound, oldReq, t0, event, nil)
+	return resp, respBody, event, nil
 }
 
-func (inbound *Inbound) error(title, outbound string, err error, t0 time.Time) error {
+// error classifies the given error and records it in the given event.
+func (inbound *Inbound) error(
+	title, outbound string, httpReq *http.Request, err error, t0 time.Time, event *Event) error {
+
+	event.Latency = time.Since(t0)
 
 	if urlErr, ok := err.(*url.Error); ok {
-		return inbound.error(title, outbound, urlErr.Err, t0)
+		return inbound.error(title, outbound, httpReq, urlErr.Err, t0, event)
 
 	} else if netErr, ok := err.(*net.OpError); ok {
 		if errno, ok := netErr.Err.(syscall.Errno); ok && errno == syscall.ECONNREFUSED {
-			klog.KPrintf(klog.Keyf("%s.%s.%s.timeout", inbound.Name, outbound, title), "%T -> %v", err, err)
-			inbound.record(outbound, Event{Timeout: true, Latency: time.Since(t0)})
+			inbound.logError(klog.Keyf("%s.%s.%s.timeout", inbound.Name, outbound, title), httpReq, err)
+			event.Timeout = true
+			inbound.record(outbound, *event)
 			return err
 		}
 
-		return inbound.error(title, outbound, netErr.Err, t0)
+		return inbound.error(title, outbound, httpReq, netErr.Err, t0, event)
 	}
 
 	switch err.Error() {
@@ -324,7 +814,8 @@ func (inbound *Inbound) error(title, outbound string, err error, t0 time.Time) e
 	// Prevents spamming the logs with closed connections even though they were
 	// not properly closed.
 	case "EOF":
-		inbound.record(outbound, Event{Error: true, Latency: time.Since(t0)})
+		event.Error = true
+		inbound.record(outbound, *event)
 		return err
 
 	// I hate this but net and net/http provides no useful errors or indicators
@@ -336,16 +827,28 @@ func (inbound *Inbound) error(title, outbound string, err error, t0 time.Time) e
 	case "net/http: transport closed before response was received":
 		fallthrough
 	case "net/http: request canceled while waiting for connection":
-		klog.KPrintf(klog.Keyf("%s.%s.%s.timeout", inbound.Name, outbound, title), "%T -> %v", err, err)
-		inbound.record(outbound, Event{Timeout: true, Latency: time.Since(t0)})
+		inbound.logError(klog.Keyf("%s.%s.%s.timeout", inbound.Name, outbound, title), httpReq, err)
+		event.Timeout = true
+		inbound.record(outbound, *event)
 		return err
 	}
 
-	klog.KPrintf(klog.Keyf("%s.%s.%s.error", inbound.Name, outbound, title), "%T -> %v", err, err)
-	inbound.record(outbound, Event{Error: true, Latency: time.Since(t0)})
+	inbound.logError(klog.Keyf("%s.%s.%s.error", inbound.Name, outbound, title), httpReq, err)
+	event.Error = true
+	inbound.record(outbound, *event)
 	return err
 }
 
+func (inbound *Inbound) logError(key string, httpReq *http.Request, err error) {
+	if len(inbound.RequestIDHeader) > 0 {
+		requestID := httpReq.Header.Get(inbound.RequestIDHeader)
+		klog.KPrintf(key, "request %s: %T -> %v", requestID, err, err)
+		return
+	}
+
+	klog.KPrintf(key, "%T -> %v", err, err)
+}
+
 // UnmarshalJSON defines a custom JSON format for the encoding/json package.
 func (inbound *Inbound) UnmarshalJSON(body []byte) (err error) {
 	var inboundJSON struct {
@@ -359,6 +862,17 @@ func (inbound *Inbound) UnmarshalJSON(body []byte) (err error) {
 		TimeoutCode int    `json:"timeoutCode,omitempty"`
 
 		IdleConnections int `json:"idleConn"`
+
+		Routes          []string `json:"routes,omitempty"`
+		StatsWindows    []string `json:"statsWindows,omitempty"`
+		SlowerThreshold string   `json:"slowerThreshold,omitempty"`
+		StatsHistory    int      `json:"statsHistory,omitempty"`
+		RequestIDHeader string   `json:"requestIdHeader,omitempty"`
+		ErrorSamples    int      `json:"errorSamples,omitempty"`
+		SlowRequest     string   `json:"slowRequest,omitempty"`
+
+		AccessLog       string `json:"accessLog,omitempty"`
+		AccessLogFormat string `json:"accessLogFormat,omitempty"`
 	}
 
 	if err = json.Unmarshal(body, &inboundJSON); err != nil {
@@ -377,6 +891,32 @@ func (inbound *Inbound) UnmarshalJSON(body []byte) (err error) {
 	inbound.TimeoutCode = inboundJSON.TimeoutCode
 
 	inbound.IdleConnections = inboundJSON.IdleConnections
+	inbound.Routes = inboundJSON.Routes
+	inbound.StatsHistory = inboundJSON.StatsHistory
+	inbound.RequestIDHeader = inboundJSON.RequestIDHeader
+	inbound.ErrorSamples = inboundJSON.ErrorSamples
+
+	if len(inboundJSON.SlowRequest) > 0 {
+		if inbound.SlowRequest, err = time.ParseDuration(inboundJSON.SlowRequest); err != nil {
+			return
+		}
+	}
+	inbound.AccessLog = inboundJSON.AccessLog
+	inbound.AccessLogFormat = inboundJSON.AccessLogFormat
+
+	if len(inboundJSON.SlowerThreshold) > 0 {
+		if inbound.SlowerThreshold, err = time.ParseDuration(inboundJSON.SlowerThreshold); err != nil {
+			return
+		}
+	}
+
+	for _, window := range inboundJSON.StatsWindows {
+		var length time.Duration
+		if length, err = time.ParseDuration(window); err != nil {
+			return
+		}
+		inbound.StatsWindows = append(inbound.StatsWindows, length)
+	}
 
 	return
 }
@@ -394,6 +934,17 @@ func (inbound *Inbound) MarshalJSON() ([]byte, error) {
 		TimeoutCode int    `json:"timeoutCode,omitempty"`
 
 		IdleConnections int `json:"idleConn"`
+
+		Routes          []string `json:"routes,omitempty"`
+		StatsWindows    []string `json:"statsWindows,omitempty"`
+		SlowerThreshold string   `json:"slowerThreshold,omitempty"`
+		StatsHistory    int      `json:"statsHistory,omitempty"`
+		RequestIDHeader string   `json:"requestIdHeader,omitempty"`
+		ErrorSamples    int      `json:"errorSamples,omitempty"`
+		SlowRequest     string   `json:"slowRequest,omitempty"`
+
+		AccessLog       string `json:"accessLog,omitempty"`
+		AccessLogFormat string `json:"accessLogFormat,omitempty"`
 	}
 
 	inboundJSON.Name = inbound.Name
@@ -406,6 +957,24 @@ func (inbound *Inbound) MarshalJSON() ([]byte, error) {
 	inboundJSON.TimeoutCode = inbound.TimeoutCode
 
 	inboundJSON.IdleConnections = inbound.IdleConnections
+	inboundJSON.Routes = inbound.Routes
+	inboundJSON.StatsHistory = inbound.StatsHistory
+	inboundJSON.RequestIDHeader = inbound.RequestIDHeader
+	inboundJSON.ErrorSamples = inbound.ErrorSamples
+
+	if inbound.SlowRequest > 0 {
+		inboundJSON.SlowRequest = inbound.SlowRequest.String()
+	}
+	inboundJSON.AccessLog = inbound.AccessLog
+	inboundJSON.AccessLogFormat = inbound.AccessLogFormat
+
+	if inbound.SlowerThreshold > 0 {
+		inboundJSON.SlowerThreshold = inbound.SlowerThreshold.String()
+	}
+
+	for _, window := range inbound.StatsWindows {
+		inboundJSON.StatsWindows = append(inboundJSON.StatsWindows, window.String())
+	}
 
 	return json.Marshal(&inboundJSON)
 }
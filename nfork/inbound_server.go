@@ -51,6 +51,7 @@ func NewInboundServer(inbound *Inbound) (*InboundServer, error) {
 // Close closes the HTTP server releasing all associated resources.
 func (server *InboundServer) Close() {
 	server.listener.Close()
+	server.getInbound().Close()
 }
 
 // ServeHTTP forwards the given HTTP request to the managed inbound.
@@ -64,7 +65,7 @@ func (server *InboundServer) List() *Inbound {
 }
 
 // ReadStats calls ReadStats on the managed inbound.
-func (server *InboundServer) ReadStats() map[string]*Stats {
+func (server *InboundServer) ReadStats() *InboundStats {
 	return server.getInbound().ReadStats()
 }
 
@@ -73,6 +74,46 @@ func (server *InboundServer) ReadOutboundStats(outbound string) (*Stats, error)
 	return server.getInbound().ReadOutboundStats(outbound)
 }
 
+// ReadStatsWindow calls ReadStatsWindow on the managed inbound.
+func (server *InboundServer) ReadStatsWindow(window string) (*InboundStats, error) {
+	return server.getInbound().ReadStatsWindow(window)
+}
+
+// ReadOutboundStatsWindow calls ReadOutboundStatsWindow on the managed inbound.
+func (server *InboundServer) ReadOutboundStatsWindow(outbound, window string) (*Stats, error) {
+	return server.getInbound().ReadOutboundStatsWindow(outbound, window)
+}
+
+// ReadTotalStats calls ReadTotalStats on the managed inbound.
+func (server *InboundServer) ReadTotalStats() *InboundStats {
+	return server.getInbound().ReadTotalStats()
+}
+
+// ReadHistory calls ReadHistory on the managed inbound.
+func (server *InboundServer) ReadHistory() *InboundHistory {
+	return server.getInbound().ReadHistory()
+}
+
+// ReadOutboundHistory calls ReadOutboundHistory on the managed inbound.
+func (server *InboundServer) ReadOutboundHistory(outbound string) ([]*StatsSample, error) {
+	return server.getInbound().ReadOutboundHistory(outbound)
+}
+
+// ReadOutboundErrors calls ReadOutboundErrors on the managed inbound.
+func (server *InboundServer) ReadOutboundErrors(outbound string) ([]*ErrorSample, error) {
+	return server.getInbound().ReadOutboundErrors(outbound)
+}
+
+// ResetStats calls ResetStats on the managed inbound.
+func (server *InboundServer) ResetStats() {
+	server.getInbound().ResetStats()
+}
+
+// ResetOutboundStats calls ResetOutboundStats on the managed inbound.
+func (server *InboundServer) ResetOutboundStats(outbound string) error {
+	return server.getInbound().ResetOutboundStats(outbound)
+}
+
 // AddOutbound calls AddOutbound on the managed inbound.
 func (server *InboundServer) AddOutbound(outbound, addr string) error {
 	inbound := server.getInbound().Copy()
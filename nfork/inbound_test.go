@@ -7,6 +7,8 @@ import (
 	"github.com/datacratic/goklog/klog"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"runtime"
 	"testing"
 	"time"
 )
@@ -44,6 +46,176 @@ func TestInbound(t *testing.T) {
 	s0.Expect("{GET /a r00}", "{PUT /a/b r01}", "{POST /a/b/c r02}")
 	s1.Expect("{GET /a r00}", "{PUT /a/b r01}", "{POST /a/b/c r02}")
 	s2.Expect("{GET /a r00}", "{PUT /a/b r01}", "{POST /a/b/c r02}")
+
+	stats := inbound.ReadTotalStats()
+	if stats.Inbound.Requests != 3 || stats.Inbound.Responses[http.StatusCreated] != 3 {
+		t.Errorf("FAIL(stats): unexpected inbound stats -> %+v", stats.Inbound)
+	}
+	if stats.InFlight != 0 {
+		t.Errorf("FAIL(stats): unexpected in-flight requests -> %d", stats.InFlight)
+	}
+	if stats.Outbounds["s0"].Requests != 3 {
+		t.Errorf("FAIL(stats): unexpected outbound stats -> %+v", stats.Outbounds["s0"])
+	}
+
+	if comp := stats.Outbounds["s0"].Comparison; comp == nil || comp.Requests != 3 {
+		t.Errorf("FAIL(stats): unexpected s0 comparison -> %+v", comp)
+	}
+	if comp := stats.Outbounds["s0"].Comparison; comp == nil || !reflect.DeepEqual(comp.Codes, CodeMatrix{"201": {"200": 3}}) {
+		t.Errorf("FAIL(stats): unexpected s0 codes -> %+v", comp)
+	}
+
+	// Requests to s2 are cancelled by the client timeout which is classified
+	// as an error.
+	if comp := stats.Outbounds["s2"].Comparison; comp == nil || comp.Requests != 0 || !reflect.DeepEqual(comp.Codes, CodeMatrix{"201": {ErrorClass: 3}}) {
+		t.Errorf("FAIL(stats): unexpected s2 comparison -> %+v", comp)
+	}
+	if comp := stats.Outbounds["s1"].Comparison; comp != nil {
+		t.Errorf("FAIL(stats): unexpected active comparison -> %+v", comp)
+	}
+
+	if conn := stats.Outbounds["s1"].Connection; conn == nil || conn.Connections != 3 || conn.FirstByte.Count != 3 || conn.Connect.Count == 0 {
+		t.Errorf("FAIL(stats): unexpected s1 connection stats -> %+v", conn)
+	}
+	if conn := stats.Inbound.Connection; conn != nil {
+		t.Errorf("FAIL(stats): unexpected inbound connection stats -> %+v", conn)
+	}
+
+	if samples, _ := inbound.ReadOutboundErrors("s0"); len(samples) != 0 {
+		t.Errorf("FAIL(errors): unexpected s0 samples -> %v", samples)
+	}
+
+	if samples, _ := inbound.ReadOutboundErrors("s2"); len(samples) != 3 {
+		t.Errorf("FAIL(errors): unexpected s2 samples -> %v", samples)
+	} else {
+		// Requests to s2 time out concurrently so their samples can be added
+		// in any order.
+		paths := make(map[string]bool)
+		for i, sample := range samples {
+			paths[sample.Path] = true
+			if sample.Category != ErrorCategory && sample.Category != TimeoutCategory {
+				t.Errorf("FAIL(errors): unexpected s2 sample %d -> %+v", i, sample)
+			}
+		}
+		for _, path := range []string{"/a", "/a/b", "/a/b/c"} {
+			if !paths[path] {
+				t.Errorf("FAIL(errors): missing s2 sample for %s -> %v", path, samples)
+			}
+		}
+	}
+
+	if inbound.SlowRequest != 0 {
+		t.Errorf("FAIL(errors): default slow request written to the inbound -> %s", inbound.SlowRequest)
+	}
+
+	if err := inbound.ResetOutboundStats("s0"); err != nil {
+		t.Errorf("FAIL(reset): unexpected error -> %s", err)
+	}
+	if err := inbound.ResetOutboundStats("bob"); err == nil {
+		t.Errorf("FAIL(reset): expected unknown outbound error")
+	}
+
+	stats = inbound.ReadTotalStats()
+	if stats.Outbounds["s0"].Requests != 0 || stats.Outbounds["s0"].Comparison != nil {
+		t.Errorf("FAIL(reset): unexpected s0 stats -> %+v", stats.Outbounds["s0"])
+	}
+	if stats.Outbounds["s1"].Requests != 3 || stats.Inbound.Requests != 3 {
+		t.Errorf("FAIL(reset): unexpected stats after outbound reset -> %+v", stats)
+	}
+
+	inbound.ResetStats()
+
+	stats = inbound.ReadTotalStats()
+	if stats.Outbounds["s1"].Requests != 0 || stats.Inbound.Requests != 0 {
+		t.Errorf("FAIL(reset): unexpected stats after inbound reset -> %+v", stats)
+	}
+}
+
+func TestInboundRequestID(t *testing.T) {
+	idC := make(chan string, 10)
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		idC <- httpReq.Header.Get("X-Request-Id")
+	})
+
+	server0 := httptest.NewServer(handler)
+	defer server0.Close()
+
+	server1 := httptest.NewServer(handler)
+	defer server1.Close()
+
+	inbound := &Inbound{
+		Name:            "bob",
+		Outbound:        map[string]string{"s0": server0.URL, "s1": server1.URL},
+		Active:          "s0",
+		RequestIDHeader: "X-Request-Id",
+	}
+	server := httptest.NewServer(inbound)
+	defer server.Close()
+
+	ExpectRequestID := func(title, requestID string) {
+		req, _ := http.NewRequest("GET", server.URL+"/a", nil)
+		if len(requestID) > 0 {
+			req.Header.Set("X-Request-Id", requestID)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("FAIL(%s): unexpected error -> %s", title, err)
+		}
+		resp.Body.Close()
+
+		respID := resp.Header.Get("X-Request-Id")
+		if len(respID) == 0 || (len(requestID) > 0 && respID != requestID) {
+			t.Errorf("FAIL(%s): unexpected response ID -> '%s'", title, respID)
+		}
+
+		for i := 0; i < 2; i++ {
+			if id := <-idC; id != respID {
+				t.Errorf("FAIL(%s): unexpected outbound ID -> '%s' != '%s'", title, id, respID)
+			}
+		}
+	}
+
+	ExpectRequestID("propagate", "abc")
+	ExpectRequestID("generate", "")
+}
+
+func TestInboundClose(t *testing.T) {
+	n := runtime.NumGoroutine()
+
+	inbound := &Inbound{
+		Name:     "bob",
+		Outbound: map[string]string{"s0": "http://localhost:1", "s1": "http://localhost:2"},
+		Active:   "s0",
+	}
+	inbound.ReadStats()
+
+	for i := 0; i < 10; i++ {
+		recorder := inbound.stats["s0"]
+
+		inbound = inbound.Copy()
+		if err := inbound.AddOutbound("s1", fmt.Sprintf("http://localhost:%d", i+3)); err != nil {
+			t.Fatalf("FAIL(add): unexpected error -> %s", err)
+		}
+		inbound.ReadStats()
+
+		if inbound.stats["s0"] != recorder {
+			t.Errorf("FAIL(copy): stats recorder of s0 was replaced")
+		}
+	}
+
+	inbound = inbound.Copy()
+	if err := inbound.RemoveOutbound("s1"); err != nil {
+		t.Fatalf("FAIL(remove): unexpected error -> %s", err)
+	}
+	inbound.ReadStats()
+
+	if _, ok := inbound.stats["s1"]; ok {
+		t.Errorf("FAIL(remove): stats recorder of s1 still present")
+	}
+
+	inbound.Close()
+	ExpectGoroutines(t, "close", n)
 }
 
 func BenchmarkInbound_1(b *testing.B) {
@@ -0,0 +1,298 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package nfork
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MetricsContentType is the content type of the Prometheus text exposition
+// format produced by WriteMetrics.
+const MetricsContentType = "text/plain; version=0.0.4"
+
+// MetricsLatencyBounds are the upper bounds of the latency histogram buckets
+// exported by WriteMetrics.
+var MetricsLatencyBounds = []time.Duration{
+	1 * time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// MetricsSizeBounds are the upper bounds, in bytes, of the body size histogram
+// buckets exported by WriteMetrics.
+var MetricsSizeBounds = []uint64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304}
+
+// WriteMetrics writes the given cumulative stats, indexed by inbound, to the
+// writer using the Prometheus text exposition format. The histogram bucket
+// counts are approximated within the precision of Histogram.
+func WriteMetrics(writer io.Writer, stats map[string]*InboundStats) error {
+	var inbounds []string
+	for inbound := range stats {
+		inbounds = append(inbounds, inbound)
+	}
+	sort.Strings(inbounds)
+
+	var in, out, routes []metricsSeries
+	var inFlight []uint64
+
+	for _, inbound := range inbounds {
+		labels := fmt.Sprintf("inbound=\"%s\"", escapeLabel(inbound))
+		in = append(in, metricsSeries{labels, stats[inbound].Inbound})
+		inFlight = append(inFlight, uint64(stats[inbound].InFlight))
+
+		var outbounds []string
+		for outbound := range stats[inbound].Outbounds {
+			outbounds = append(outbounds, outbound)
+		}
+		sort.Strings(outbounds)
+
+		for _, outbound := range outbounds {
+			outStats := stats[inbound].Outbounds[outbound]
+			outLabels := fmt.Sprintf("%s,outbound=\"%s\"", labels, escapeLabel(outbound))
+			out = append(out, metricsSeries{outLabels, outStats})
+
+			var names []string
+			for route := range outStats.Routes {
+				names = append(names, route)
+			}
+			sort.Strings(names)
+
+			for _, route := range names {
+				routeLabels := fmt.Sprintf("%s,route=\"%s\"", outLabels, escapeLabel(route))
+				routes = append(routes, metricsSeries{routeLabels, outStats.Routes[route]})
+			}
+		}
+	}
+
+	var latencyBounds []uint64
+	for _, bound := range MetricsLatencyBounds {
+		latencyBounds = append(latencyBounds, uint64(bound))
+	}
+
+	requests := func(stats *Stats) uint64 { return stats.Requests }
+	errors := func(stats *Stats) uint64 { return stats.Errors }
+	timeouts := func(stats *Stats) uint64 { return stats.Timeouts }
+	latency := func(stats *Stats) *Histogram { return &stats.Latency }
+
+	w := &metricsWriter{Buffer: new(bytes.Buffer)}
+
+	w.gauge("nfork_inbound_in_flight", "Number of requests currently processed by an inbound.", in, inFlight)
+	w.counter("nfork_inbound_requests_total", "Number of requests received by an inbound.", in, requests)
+	w.counter("nfork_inbound_body_errors_total", "Number of requests whose body couldn't be read.", in,
+		func(stats *Stats) uint64 { return stats.BodyErrors })
+	w.counter("nfork_inbound_failures_total", "Number of requests where the active outbound failed.", in,
+		func(stats *Stats) uint64 { return stats.Failures })
+	w.responses("nfork_inbound_responses_total", "Number of responses sent by an inbound by HTTP status code.", in)
+	w.histogram("nfork_inbound_latency_seconds", "End-to-end latency of the requests received by an inbound.",
+		in, latency, latencyBounds, formatSeconds)
+
+	w.counter("nfork_requests_total", "Number of requests forwarded to an outbound.", out, requests)
+	w.counter("nfork_errors_total", "Number of requests to an outbound that failed.", out, errors)
+	w.counter("nfork_timeouts_total", "Number of requests to an outbound that timed out.", out, timeouts)
+	w.counter("nfork_request_bytes_total", "Number of bytes sent in request bodies to an outbound.", out,
+		func(stats *Stats) uint64 { return stats.RequestBytes })
+	w.counter("nfork_response_bytes_total", "Number of bytes received in response bodies from an outbound.", out,
+		func(stats *Stats) uint64 { return stats.ResponseBytes })
+	w.responses("nfork_responses_total", "Number of responses received from an outbound by HTTP status code.", out)
+	w.histogram("nfork_latency_seconds", "Latency of the requests forwarded to an outbound.",
+		out, latency, latencyBounds, formatSeconds)
+
+	var classes []metricsSeries
+	for _, series := range out {
+		var names []string
+		for class := range series.stats.ClassLatency {
+			names = append(names, class)
+		}
+		sort.Strings(names)
+
+		for _, class := range names {
+			labels := fmt.Sprintf("%s,class=\"%s\"", series.labels, class)
+			classes = append(classes, metricsSeries{labels, &Stats{Latency: *series.stats.ClassLatency[class]}})
+		}
+	}
+	w.histogram("nfork_class_latency_seconds", "Latency of the requests forwarded to an outbound by status class, error or timeout.",
+		classes, latency, latencyBounds, formatSeconds)
+
+	if len(routes) > 0 {
+		w.counter("nfork_route_requests_total", "Number of requests forwarded to an outbound by route.", routes, requests)
+		w.counter("nfork_route_errors_total", "Number of requests to an outbound that failed by route.", routes, errors)
+		w.counter("nfork_route_timeouts_total", "Number of requests to an outbound that timed out by route.", routes, timeouts)
+		w.histogram("nfork_route_latency_seconds", "Latency of the requests forwarded to an outbound by route.",
+			routes, latency, latencyBounds, formatSeconds)
+	}
+
+	var compared []metricsSeries
+	for _, series := range out {
+		if series.stats.Comparison != nil {
+			compared = append(compared, series)
+		}
+	}
+
+	if len(compared) > 0 {
+		w.codes("nfork_comparison_codes_total", "Number of requests by outcome of the active outbound and of a shadow.", compared)
+		w.counter("nfork_comparison_requests_total", "Number of requests compared between a shadow and the active outbound.",
+			compared, func(stats *Stats) uint64 { return stats.Comparison.Requests })
+		w.counter("nfork_comparison_over_threshold_total", "Number of requests where a shadow was slower than the active outbound by more than the threshold.",
+			compared, func(stats *Stats) uint64 { return stats.Comparison.OverThreshold })
+		w.histogram("nfork_comparison_slower_seconds", "Latency difference when a shadow was slower than the active outbound.",
+			compared, func(stats *Stats) *Histogram { return &stats.Comparison.Slower }, latencyBounds, formatSeconds)
+		w.histogram("nfork_comparison_faster_seconds", "Latency difference when a shadow was faster than the active outbound.",
+			compared, func(stats *Stats) *Histogram { return &stats.Comparison.Faster }, latencyBounds, formatSeconds)
+	}
+
+	var connected []metricsSeries
+	for _, series := range out {
+		if series.stats.Connection != nil {
+			connected = append(connected, series)
+		}
+	}
+
+	if len(connected) > 0 {
+		connection := func(value func(*ConnectionStats) *Histogram) func(*Stats) *Histogram {
+			return func(stats *Stats) *Histogram { return value(stats.Connection) }
+		}
+
+		w.counter("nfork_connections_total", "Number of requests to an outbound which obtained a connection.",
+			connected, func(stats *Stats) uint64 { return stats.Connection.Connections })
+		w.counter("nfork_connections_reused_total", "Number of requests to an outbound which reused an idle connection.",
+			connected, func(stats *Stats) uint64 { return stats.Connection.Reused })
+		w.histogram("nfork_dns_seconds", "Duration of the DNS lookups made for an outbound.", connected,
+			connection(func(conn *ConnectionStats) *Histogram { return &conn.DNS }), latencyBounds, formatSeconds)
+		w.histogram("nfork_connect_seconds", "Duration required to establish new connections to an outbound.", connected,
+			connection(func(conn *ConnectionStats) *Histogram { return &conn.Connect }), latencyBounds, formatSeconds)
+		w.histogram("nfork_tls_handshake_seconds", "Duration of the TLS handshakes with an outbound.", connected,
+			connection(func(conn *ConnectionStats) *Histogram { return &conn.TLSHandshake }), latencyBounds, formatSeconds)
+		w.histogram("nfork_first_byte_seconds", "Duration until the first byte of the responses of an outbound.", connected,
+			connection(func(conn *ConnectionStats) *Histogram { return &conn.FirstByte }), latencyBounds, formatSeconds)
+	}
+
+	w.histogram("nfork_request_size_bytes", "Size of the request bodies sent to an outbound.", out,
+		func(stats *Stats) *Histogram { return &stats.RequestSize }, MetricsSizeBounds, formatBytes)
+	w.histogram("nfork_response_size_bytes", "Size of the response bodies received from an outbound.", out,
+		func(stats *Stats) *Histogram { return &stats.ResponseSize }, MetricsSizeBounds, formatBytes)
+
+	_, err := w.WriteTo(writer)
+	return err
+}
+
+type metricsSeries struct {
+	labels string
+	stats  *Stats
+}
+
+type metricsWriter struct {
+	*bytes.Buffer
+}
+
+func (w *metricsWriter) header(name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (w *metricsWriter) gauge(name, help string, all []metricsSeries, values []uint64) {
+	w.header(name, "gauge", help)
+	for i, series := range all {
+		fmt.Fprintf(w, "%s{%s} %d\n", name, series.labels, values[i])
+	}
+}
+
+func (w *metricsWriter) counter(name, help string, all []metricsSeries, value func(*Stats) uint64) {
+	w.header(name, "counter", help)
+	for _, series := range all {
+		fmt.Fprintf(w, "%s{%s} %d\n", name, series.labels, value(series.stats))
+	}
+}
+
+func (w *metricsWriter) responses(name, help string, all []metricsSeries) {
+	w.header(name, "counter", help)
+	for _, series := range all {
+		var codes []int
+		for code := range series.stats.Responses {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+
+		for _, code := range codes {
+			fmt.Fprintf(w, "%s{%s,code=\"%d\"} %d\n", name, series.labels, code, series.stats.Responses[code])
+		}
+	}
+}
+
+func (w *metricsWriter) codes(name, help string, all []metricsSeries) {
+	w.header(name, "counter", help)
+	for _, series := range all {
+		codes := series.stats.Comparison.Codes
+
+		var actives []string
+		for active := range codes {
+			actives = append(actives, active)
+		}
+		sort.Strings(actives)
+
+		for _, active := range actives {
+			var shadows []string
+			for shadow := range codes[active] {
+				shadows = append(shadows, shadow)
+			}
+			sort.Strings(shadows)
+
+			for _, shadow := range shadows {
+				fmt.Fprintf(w, "%s{%s,active=\"%s\",shadow=\"%s\"} %d\n",
+					name, series.labels, active, shadow, codes[active][shadow])
+			}
+		}
+	}
+}
+
+func (w *metricsWriter) histogram(
+	name, help string, all []metricsSeries,
+	value func(*Stats) *Histogram, bounds []uint64, format func(uint64) string) {
+
+	w.header(name, "histogram", help)
+	for _, series := range all {
+		hist := value(series.stats)
+		for _, bound := range bounds {
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, series.labels, format(bound), hist.CountBelow(bound))
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, series.labels, hist.Count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", name, series.labels, format(hist.Sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, series.labels, hist.Count)
+	}
+}
+
+// ServeMetrics is an HTTP handler which exposes the cumulative stats of all
+// the inbounds in the Prometheus text exposition format.
+func (control *Controller) ServeMetrics(writer http.ResponseWriter, httpReq *http.Request) {
+	writer.Header().Set("Content-Type", MetricsContentType)
+	WriteMetrics(writer, control.ReadTotalStats())
+}
+
+func formatSeconds(value uint64) string {
+	return strconv.FormatFloat(time.Duration(value).Seconds(), 'g', -1, 64)
+}
+
+func formatBytes(value uint64) string {
+	return strconv.FormatUint(value, 10)
+}
+
+var labelEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package nfork
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	stats := new(Stats)
+	stats.record(Event{Response: 200, Latency: 2 * time.Millisecond, RequestBytes: 10, ResponseBytes: 100,
+		Connection: ConnectionTrace{Obtained: true, Connect: 2 * time.Millisecond, FirstByte: 2 * time.Millisecond}})
+	stats.record(Event{Response: 404, Latency: 20 * time.Millisecond, RequestBytes: 10, ResponseBytes: 1000,
+		Connection: ConnectionTrace{Obtained: true, Reused: true, FirstByte: 20 * time.Millisecond}})
+	stats.record(Event{Timeout: true, Latency: 2 * time.Second, Route: "/users/:id"})
+	stats.recordComparison(Event{Response: 200, Latency: 1 * time.Millisecond},
+		Event{Response: 500, Latency: 20 * time.Millisecond}, 10*time.Millisecond)
+	stats.recordComparison(Event{Response: 200, Latency: 1 * time.Millisecond},
+		Event{Response: 200, Latency: 5 * time.Millisecond}, 10*time.Millisecond)
+
+	buffer := new(bytes.Buffer)
+	inStats := new(Stats)
+	inStats.record(Event{Response: 200, Latency: 3 * time.Millisecond})
+	inStats.record(Event{Failed: true, Response: 503, Latency: 50 * time.Millisecond})
+
+	if err := WriteMetrics(buffer, map[string]*InboundStats{"i0": {
+		Inbound:   inStats,
+		InFlight:  2,
+		Outbounds: map[string]*Stats{"s\"0": stats},
+	}}); err != nil {
+		t.Fatalf("FAIL: unable to write metrics -> %s", err)
+	}
+
+	labels := `inbound="i0",outbound="s\"0"`
+	for _, line := range []string{
+		"# TYPE nfork_inbound_in_flight gauge",
+		"nfork_inbound_in_flight{inbound=\"i0\"} 2",
+		"nfork_inbound_requests_total{inbound=\"i0\"} 2",
+		"nfork_inbound_body_errors_total{inbound=\"i0\"} 0",
+		"nfork_inbound_failures_total{inbound=\"i0\"} 1",
+		"nfork_inbound_responses_total{inbound=\"i0\",code=\"200\"} 1",
+		"nfork_inbound_responses_total{inbound=\"i0\",code=\"503\"} 1",
+		"nfork_inbound_latency_seconds_bucket{inbound=\"i0\",le=\"0.005\"} 1",
+		"# TYPE nfork_requests_total counter",
+		"nfork_requests_total{" + labels + "} 3",
+		"nfork_errors_total{" + labels + "} 0",
+		"nfork_timeouts_total{" + labels + "} 1",
+		"nfork_request_bytes_total{" + labels + "} 20",
+		"nfork_response_bytes_total{" + labels + "} 1100",
+		"nfork_response_size_bytes_bucket{" + labels + ",le=\"256\"} 1",
+		"nfork_response_size_bytes_bucket{" + labels + ",le=\"1024\"} 2",
+		"nfork_response_size_bytes_count{" + labels + "} 2",
+		"nfork_route_requests_total{" + labels + ",route=\"/users/:id\"} 1",
+		"nfork_route_timeouts_total{" + labels + ",route=\"/users/:id\"} 1",
+		"nfork_route_latency_seconds_count{" + labels + ",route=\"/users/:id\"} 1",
+		"nfork_comparison_codes_total{" + labels + ",active=\"200\",shadow=\"200\"} 1",
+		"nfork_comparison_codes_total{" + labels + ",active=\"200\",shadow=\"500\"} 1",
+		"nfork_comparison_requests_total{" + labels + "} 2",
+		"nfork_comparison_over_threshold_total{" + labels + "} 1",
+		"nfork_comparison_slower_seconds_bucket{" + labels + ",le=\"0.005\"} 1",
+		"nfork_responses_total{" + labels + ",code=\"200\"} 1",
+		"nfork_responses_total{" + labels + ",code=\"404\"} 1",
+		"# TYPE nfork_latency_seconds histogram",
+		"nfork_latency_seconds_bucket{" + labels + ",le=\"0.001\"} 0",
+		"nfork_latency_seconds_bucket{" + labels + ",le=\"0.0025\"} 1",
+		"nfork_latency_seconds_bucket{" + labels + ",le=\"0.025\"} 2",
+		"nfork_latency_seconds_bucket{" + labels + ",le=\"2.5\"} 3",
+		"nfork_latency_seconds_bucket{" + labels + ",le=\"+Inf\"} 3",
+		"nfork_latency_seconds_sum{" + labels + "} 2.022",
+		"nfork_latency_seconds_count{" + labels + "} 3",
+		"nfork_class_latency_seconds_count{" + labels + ",class=\"2xx\"} 1",
+		"nfork_class_latency_seconds_count{" + labels + ",class=\"4xx\"} 1",
+		"nfork_class_latency_seconds_bucket{" + labels + ",class=\"timeout\",le=\"2.5\"} 1",
+		"nfork_connections_total{" + labels + "} 2",
+		"nfork_connections_reused_total{" + labels + "} 1",
+		"nfork_connect_seconds_count{" + labels + "} 1",
+		"nfork_dns_seconds_count{" + labels + "} 0",
+		"nfork_first_byte_seconds_bucket{" + labels + ",le=\"0.0025\"} 1",
+		"nfork_first_byte_seconds_count{" + labels + "} 2",
+	} {
+		if !strings.Contains(buffer.String(), line+"\n") {
+			t.Errorf("FAIL: missing line '%s' in:\n%s", line, buffer.String())
+		}
+	}
+}
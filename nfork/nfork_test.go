@@ -10,6 +10,7 @@ import (
 	"io/ioutil"
 	"math/rand"
 	"net/http"
+	"runtime"
 	"sync"
 	"testing"
 	"time"
@@ -154,3 +155,19 @@ func SendTo(URL, method, path, body string) (*http.Response, string, error) {
 
 	return resp, string(respBody), err
 }
+
+// ExpectGoroutines waits for the number of running goroutines to drop back to
+// the given count and fails if it doesn't happen within a second.
+func ExpectGoroutines(t *testing.T, title string, exp int) {
+	var n int
+	for i := 0; i < 100; i++ {
+		if n = runtime.NumGoroutine(); n <= exp {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	buf := make([]byte, 1<<16)
+	buf = buf[:runtime.Stack(buf, true)]
+	t.Errorf("FAIL(%s): leaked goroutines -> %d > %d\n%s", title, n, exp, buf)
+}
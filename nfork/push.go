@@ -0,0 +1,303 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package nfork
+
+import (
+	"github.com/datacratic/goklog/klog"
+
+	"bytes"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// StatsPublisher is notified of the stats of an outbound every time they are
+// updated by its StatsRecorder. The stats of the inbound itself are published
+// with an empty outbound.
+type StatsPublisher interface {
+	PublishStats(inbound, outbound string, stats *Stats)
+}
+
+// Formats supported by StatsPusher.
+const (
+	FormatStatsD = "statsd"
+	FormatCarbon = "carbon"
+)
+
+// DefaultPushTemplate is used if Template is not set in StatsPusher.
+const DefaultPushTemplate = "nfork.{{.Inbound}}.{{.Outbound}}.{{.Metric}}"
+
+// InboundPushName is the outbound name used by StatsPusher to build the names
+// of the metrics of the inbound itself.
+const InboundPushName = "_inbound"
+
+// MaxPushPacketSize is the maximum size of a UDP packet sent by StatsPusher
+// which is chosen to avoid IP fragmentation on ethernet networks.
+const MaxPushPacketSize = 1432
+
+// DefaultPushQueueSize is used if QueueSize is not set in StatsPusher.
+const DefaultPushQueueSize = 1024
+
+// StatsPusher is a StatsPublisher which pushes stats to a StatsD or a Carbon
+// (Graphite) endpoint. Stats are queued and sent asynchronously and are dropped
+// if the queue is full so that a slow endpoint never holds up the recorders.
+type StatsPusher struct {
+
+	// Addr is the host and port of the endpoint.
+	Addr string
+
+	// Network is either "udp" or "tcp". Defaults to "udp".
+	Network string
+
+	// Format is either FormatStatsD or FormatCarbon. Defaults to FormatStatsD.
+	Format string
+
+	// Template is a text/template used to build the name of each metric. The
+	// fields Inbound, Outbound and Metric are available in the template.
+	// Outbound is set to InboundPushName for the stats of the inbound itself.
+	Template string
+
+	// QueueSize is the maximum number of stats waiting to be pushed.
+	QueueSize int
+
+	initialize sync.Once
+
+	template *template.Template
+	conn     net.Conn
+
+	statsC    chan pushedStats
+	shutdownC chan int
+}
+
+type pushedStats struct {
+	inbound, outbound string
+	stats             *Stats
+	ts                time.Time
+}
+
+// Init initializes the object.
+func (pusher *StatsPusher) Init() {
+	pusher.initialize.Do(pusher.init)
+}
+
+func (pusher *StatsPusher) init() {
+	if len(pusher.Network) == 0 {
+		pusher.Network = "udp"
+	}
+
+	if len(pusher.Format) == 0 {
+		pusher.Format = FormatStatsD
+	}
+
+	if len(pusher.Template) == 0 {
+		pusher.Template = DefaultPushTemplate
+	}
+
+	if pusher.QueueSize == 0 {
+		pusher.QueueSize = DefaultPushQueueSize
+	}
+
+	pusher.template = template.Must(template.New("push").Parse(pusher.Template))
+
+	pusher.statsC = make(chan pushedStats, pusher.QueueSize)
+	pusher.shutdownC = make(chan int)
+	go pusher.run()
+}
+
+// Validate returns an error if one of the StatsPusher invariants are not
+// satisfied.
+func (pusher *StatsPusher) Validate() error {
+	if len(pusher.Addr) == 0 {
+		return fmt.Errorf("missing push address")
+	}
+
+	if pusher.Network != "" && pusher.Network != "udp" && pusher.Network != "tcp" {
+		return fmt.Errorf("unknown push network '%s'", pusher.Network)
+	}
+
+	if pusher.Format != "" && pusher.Format != FormatStatsD && pusher.Format != FormatCarbon {
+		return fmt.Errorf("unknown push format '%s'", pusher.Format)
+	}
+
+	if len(pusher.Template) > 0 {
+		if _, err := template.New("push").Parse(pusher.Template); err != nil {
+			return fmt.Errorf("invalid push template: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// Close terminates the pusher.
+func (pusher *StatsPusher) Close() {
+	pusher.Init()
+	pusher.shutdownC <- 1
+}
+
+// PublishStats queues the given stats to be pushed.
+func (pusher *StatsPusher) PublishStats(inbound, outbound string, stats *Stats) {
+	pusher.Init()
+
+	select {
+	case pusher.statsC <- pushedStats{inbound, outbound, stats, time.Now()}:
+	default:
+		klog.KPrintf("push.dropped", "queue full, dropping stats for '%s.%s'", inbound, outbound)
+	}
+}
+
+func (pusher *StatsPusher) run() {
+	for {
+		select {
+		case stats := <-pusher.statsC:
+			pusher.push(stats)
+
+		case <-pusher.shutdownC:
+			if pusher.conn != nil {
+				pusher.conn.Close()
+			}
+			return
+		}
+	}
+}
+
+func (pusher *StatsPusher) push(stats pushedStats) {
+	if pusher.conn == nil {
+		conn, err := net.DialTimeout(pusher.Network, pusher.Addr, 1*time.Second)
+		if err != nil {
+			klog.KPrintf("push.error", "unable to connect to '%s': %s", pusher.Addr, err)
+			return
+		}
+		pusher.conn = conn
+	}
+
+	pusher.conn.SetWriteDeadline(time.Now().Add(1 * time.Second))
+
+	for _, packet := range pusher.format(stats) {
+		if _, err := pusher.conn.Write(packet); err != nil {
+			klog.KPrintf("push.error", "unable to write to '%s': %s", pusher.Addr, err)
+			pusher.conn.Close()
+			pusher.conn = nil
+			return
+		}
+	}
+}
+
+type pushMetric struct {
+	name  string
+	value string
+	kind  string
+}
+
+// format returns the lines to send for the given stats split in packets. Only
+// UDP packets are limited to MaxPushPacketSize.
+func (pusher *StatsPusher) format(stats pushedStats) (packets [][]byte) {
+	var metrics []pushMetric
+
+	counter := func(name string, value uint64) {
+		metrics = append(metrics, pushMetric{name, fmt.Sprintf("%d", value), "c"})
+	}
+
+	timer := func(name string, value uint64) {
+		ms := float64(value) / float64(time.Millisecond)
+		metrics = append(metrics, pushMetric{name, fmt.Sprintf("%g", ms), "ms"})
+	}
+
+	counter("requests", stats.stats.Requests)
+	counter("errors", stats.stats.Errors)
+	counter("timeouts", stats.stats.Timeouts)
+	if len(stats.outbound) == 0 {
+		counter("body_errors", stats.stats.BodyErrors)
+		counter("failures", stats.stats.Failures)
+	}
+	counter("bytes.request", stats.stats.RequestBytes)
+	counter("bytes.response", stats.stats.ResponseBytes)
+
+	var codes []int
+	for code := range stats.stats.Responses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		counter(fmt.Sprintf("responses.%d", code), stats.stats.Responses[code])
+	}
+
+	gauge := func(name string, value uint64) {
+		metrics = append(metrics, pushMetric{name, fmt.Sprintf("%d", value), "g"})
+	}
+
+	size := func(prefix string, hist *Histogram) {
+		p50, p90, p99, max := hist.Percentiles()
+		gauge(prefix+".p50", p50)
+		gauge(prefix+".p90", p90)
+		gauge(prefix+".p99", p99)
+		gauge(prefix+".max", max)
+	}
+
+	size("size.request", &stats.stats.RequestSize)
+	size("size.response", &stats.stats.ResponseSize)
+
+	latency := func(prefix string, hist *Histogram) {
+		p50, p90, p99, max := hist.Percentiles()
+		timer(prefix+".p50", p50)
+		timer(prefix+".p90", p90)
+		timer(prefix+".p99", p99)
+		timer(prefix+".max", max)
+	}
+
+	latency("latency", &stats.stats.Latency)
+
+	var classes []string
+	for class := range stats.stats.ClassLatency {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	for _, class := range classes {
+		latency("latency."+class, stats.stats.ClassLatency[class])
+	}
+
+	buffer := new(bytes.Buffer)
+	for _, metric := range metrics {
+		name := pusher.name(stats.inbound, stats.outbound, metric.name)
+
+		var line string
+		if pusher.Format == FormatCarbon {
+			line = fmt.Sprintf("%s %s %d\n", name, metric.value, stats.ts.Unix())
+		} else {
+			line = fmt.Sprintf("%s:%s|%s\n", name, metric.value, metric.kind)
+		}
+
+		if pusher.Network == "udp" && buffer.Len() > 0 && buffer.Len()+len(line) > MaxPushPacketSize {
+			packets = append(packets, buffer.Bytes())
+			buffer = new(bytes.Buffer)
+		}
+		buffer.WriteString(line)
+	}
+
+	if buffer.Len() > 0 {
+		packets = append(packets, buffer.Bytes())
+	}
+
+	return
+}
+
+var invalidMetricChars = regexp.MustCompile("[^a-zA-Z0-9_-]")
+
+func (pusher *StatsPusher) name(inbound, outbound, metric string) string {
+	var data struct{ Inbound, Outbound, Metric string }
+	data.Inbound = invalidMetricChars.ReplaceAllString(inbound, "_")
+	data.Outbound = invalidMetricChars.ReplaceAllString(outbound, "_")
+	if len(outbound) == 0 {
+		data.Outbound = InboundPushName
+	}
+	data.Metric = metric
+
+	buffer := new(bytes.Buffer)
+	if err := pusher.template.Execute(buffer, &data); err != nil {
+		klog.KPrintf("push.error", "unable to execute template: %s", err)
+	}
+	return buffer.String()
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package nfork
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsPusher(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %s", err)
+	}
+	defer conn.Close()
+
+	pusher := &StatsPusher{Addr: conn.LocalAddr().String(), Template: "test.{{.Outbound}}.{{.Metric}}"}
+	if err := pusher.Validate(); err != nil {
+		t.Fatalf("FAIL: invalid pusher -> %s", err)
+	}
+	defer pusher.Close()
+
+	stats := new(Stats)
+	stats.record(Event{Response: 200, Latency: 2 * time.Millisecond, RequestBytes: 10})
+	stats.record(Event{Error: true, Latency: 1 * time.Millisecond, RequestBytes: 10})
+	pusher.PublishStats("i0", "s.0", stats)
+
+	body := ReadPushed(t, conn, 100*time.Millisecond, "")
+	for _, line := range []string{
+		"test.s_0.requests:2|c",
+		"test.s_0.errors:1|c",
+		"test.s_0.timeouts:0|c",
+		"test.s_0.responses.200:1|c",
+		"test.s_0.latency.max:2|ms",
+		"test.s_0.latency.2xx.max:2|ms",
+		"test.s_0.latency.error.max:1|ms",
+		"test.s_0.bytes.request:20|c",
+		"test.s_0.size.request.max:10|g",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("FAIL: missing line '%s' in:\n%s", line, body)
+		}
+	}
+}
+
+func TestStatsPusherInbound(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %s", err)
+	}
+	defer conn.Close()
+
+	pusher := &StatsPusher{Addr: conn.LocalAddr().String(), Template: "test.{{.Inbound}}.{{.Outbound}}.{{.Metric}}"}
+	defer pusher.Close()
+
+	s0 := &TestService{T: t, Name: "s0"}
+	server0 := httptest.NewServer(s0)
+	defer server0.Close()
+
+	inbound := &Inbound{
+		Name:      "i0",
+		Outbound:  map[string]string{"s0": server0.URL},
+		Active:    "s0",
+		Publisher: pusher,
+	}
+	defer inbound.Close()
+
+	server := httptest.NewServer(inbound)
+	defer server.Close()
+
+	ExpectInbound(t, server.URL, "POST", "/a", "a", http.StatusOK, "s0")
+
+	exp := "test.i0." + InboundPushName + ".requests:1|c"
+	if body := ReadPushed(t, conn, 3*time.Second, exp); !strings.Contains(body, exp+"\n") {
+		t.Errorf("FAIL: missing line '%s' in:\n%s", exp, body)
+	}
+}
+
+// ReadPushed returns the lines received on the given connection until the
+// timeout expires or until the given line is received if not empty.
+func ReadPushed(t *testing.T, conn net.PacketConn, timeout time.Duration, line string) (body string) {
+	buffer := make([]byte, MaxPushPacketSize)
+	conn.SetReadDeadline(time.Now().Add(timeout))
+
+	for len(line) == 0 || !strings.Contains(body, line+"\n") {
+		n, _, err := conn.ReadFrom(buffer)
+		if err != nil {
+			break
+		}
+		if n > MaxPushPacketSize {
+			t.Errorf("FAIL: packet too large -> %d", n)
+		}
+		body += string(buffer[:n])
+	}
+
+	return
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package nfork
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OtherRoute is the route of the requests which don't match any of the routes
+// of a RouteTable.
+const OtherRoute = "other"
+
+// RouteTable matches request paths against an ordered list of route patterns.
+// A pattern is a list of path segments where each segment must either be equal
+// to the corresponding segment of the path or be a parameter starting with ':'
+// which matches any non-empty segment (eg. /users/:id). A pattern matches all
+// the paths that start with its segments which means that a pattern without
+// parameters matches by path prefix.
+type RouteTable struct {
+	patterns []string
+	segments [][]string
+}
+
+// NewRouteTable returns a new RouteTable for the given patterns.
+func NewRouteTable(patterns []string) (*RouteTable, error) {
+	table := &RouteTable{patterns: patterns}
+
+	for _, pattern := range patterns {
+		if !strings.HasPrefix(pattern, "/") {
+			return nil, fmt.Errorf("route '%s' must start with '/'", pattern)
+		}
+
+		table.segments = append(table.segments, splitPath(pattern))
+	}
+
+	return table, nil
+}
+
+// Match returns the first pattern which matches the given path or OtherRoute
+// if none matches. An empty string is returned if the table is nil or has no
+// patterns.
+func (table *RouteTable) Match(path string) string {
+	if table == nil || len(table.patterns) == 0 {
+		return ""
+	}
+
+	segments := splitPath(path)
+
+	for i, pattern := range table.segments {
+		if matchSegments(pattern, segments) {
+			return table.patterns[i]
+		}
+	}
+
+	return OtherRoute
+}
+
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) > len(segments) {
+		return false
+	}
+
+	for i, segment := range pattern {
+		if strings.HasPrefix(segment, ":") {
+			if len(segments[i]) == 0 {
+				return false
+			}
+		} else if segment != segments[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if len(path) == 0 {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
@@ -0,0 +1,37 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package nfork
+
+import (
+	"testing"
+)
+
+func TestRouteTable(t *testing.T) {
+	table, err := NewRouteTable([]string{"/search", "/users/:id/friends", "/users/:id", "/"})
+	if err != nil {
+		t.Fatalf("FAIL: unable to create route table -> %s", err)
+	}
+
+	for path, exp := range map[string]string{
+		"/search":            "/search",
+		"/search/a/b":        "/search",
+		"/searching":         "/",
+		"/users/42":          "/users/:id",
+		"/users/42/friends/": "/users/:id/friends",
+		"/users/":            "/",
+		"/":                  "/",
+	} {
+		if route := table.Match(path); route != exp {
+			t.Errorf("FAIL(%s): unexpected route -> %s != %s", path, route, exp)
+		}
+	}
+
+	table, _ = NewRouteTable([]string{"/search"})
+	if route := table.Match("/users"); route != OtherRoute {
+		t.Errorf("FAIL(/users): unexpected route -> %s != %s", route, OtherRoute)
+	}
+
+	if _, err := NewRouteTable([]string{"search"}); err == nil {
+		t.Errorf("FAIL(search): expected invalid route error")
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package nfork
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// DefaultErrorSamples is used if ErrorSamples is not set in Inbound.
+const DefaultErrorSamples = 100
+
+// Categories of the requests kept by an ErrorRing.
+const (
+	ErrorCategory       = ErrorClass
+	TimeoutCategory     = TimeoutClass
+	ServerErrorCategory = "5xx"
+	SlowCategory        = "slow"
+)
+
+// ErrorSample describes a request to an outbound which failed or was slow.
+type ErrorSample struct {
+
+	// Time is the time at which the request was sent.
+	Time time.Time
+
+	// Method is the HTTP method of the request.
+	Method string
+
+	// Path is the URL path of the request.
+	Path string
+
+	// Category is one of ErrorCategory, TimeoutCategory, ServerErrorCategory
+	// or SlowCategory.
+	Category string
+
+	// Response is the HTTP status code received if any.
+	Response int
+
+	// Latency is the latency of the request.
+	Latency time.Duration
+
+	// Error is the error encountered if any.
+	Error string
+
+	// RequestID is the ID of the request if the inbound has a
+	// RequestIDHeader.
+	RequestID string
+}
+
+// MarshalJSON defines a custom JSON format for encoding/json.
+func (sample *ErrorSample) MarshalJSON() ([]byte, error) {
+	var sampleJSON struct {
+		Time      time.Time `json:"time"`
+		Method    string    `json:"method"`
+		Path      string    `json:"path"`
+		Category  string    `json:"category"`
+		Response  int       `json:"response,omitempty"`
+		Latency   string    `json:"latency"`
+		Error     string    `json:"error,omitempty"`
+		RequestID string    `json:"requestId,omitempty"`
+	}
+
+	sampleJSON.Time = sample.Time
+	sampleJSON.Method = sample.Method
+	sampleJSON.Path = sample.Path
+	sampleJSON.Category = sample.Category
+	sampleJSON.Response = sample.Response
+	sampleJSON.Latency = sample.Latency.String()
+	sampleJSON.Error = sample.Error
+	sampleJSON.RequestID = sample.RequestID
+
+	return json.Marshal(&sampleJSON)
+}
+
+// UnmarshalJSON defines a custom JSON format for encoding/json.
+func (sample *ErrorSample) UnmarshalJSON(body []byte) (err error) {
+	var sampleJSON struct {
+		Time      time.Time `json:"time"`
+		Method    string    `json:"method"`
+		Path      string    `json:"path"`
+		Category  string    `json:"category"`
+		Response  int       `json:"response,omitempty"`
+		Latency   string    `json:"latency"`
+		Error     string    `json:"error,omitempty"`
+		RequestID string    `json:"requestId,omitempty"`
+	}
+
+	if err = json.Unmarshal(body, &sampleJSON); err != nil {
+		return
+	}
+
+	sample.Time = sampleJSON.Time
+	sample.Method = sampleJSON.Method
+	sample.Path = sampleJSON.Path
+	sample.Category = sampleJSON.Category
+	sample.Response = sampleJSON.Response
+	sample.Error = sampleJSON.Error
+	sample.RequestID = sampleJSON.RequestID
+
+	sample.Latency, err = time.ParseDuration(sampleJSON.Latency)
+	return
+}
+
+// ErrorRing keeps the last Size samples added to it.
+type ErrorRing struct {
+
+	// Size is the maximum number of samples kept. Defaults to
+	// DefaultErrorSamples.
+	Size int
+
+	initialize sync.Once
+
+	mutex   sync.Mutex
+	samples []*ErrorSample
+	next    int
+}
+
+// Init initializes the object.
+func (ring *ErrorRing) Init() {
+	ring.initialize.Do(ring.init)
+}
+
+func (ring *ErrorRing) init() {
+	if ring.Size == 0 {
+		ring.Size = DefaultErrorSamples
+	}
+}
+
+// Add adds the given sample to the ring replacing the oldest sample if the ring
+// is full.
+func (ring *ErrorRing) Add(sample *ErrorSample) {
+	ring.Init()
+	ring.mutex.Lock()
+	defer ring.mutex.Unlock()
+
+	if ring.Size <= 0 {
+		return
+	}
+
+	if len(ring.samples) < ring.Size {
+		ring.samples = append(ring.samples, sample)
+		return
+	}
+
+	ring.samples[ring.next] = sample
+	ring.next = (ring.next + 1) % ring.Size
+}
+
+// Read returns the samples in the ring ordered from the oldest to the most
+// recent.
+func (ring *ErrorRing) Read() []*ErrorSample {
+	ring.Init()
+	ring.mutex.Lock()
+	defer ring.mutex.Unlock()
+
+	samples := make([]*ErrorSample, 0, len(ring.samples))
+	samples = append(samples, ring.samples[ring.next:]...)
+	samples = append(samples, ring.samples[:ring.next]...)
+	return samples
+}
+
+// sampleCategory returns the category of the given event or an empty string
+// if the request was successful and isn't slower than the given threshold.
+func sampleCategory(event Event, slow time.Duration) string {
+	switch {
+	case event.Error:
+		return ErrorCategory
+	case event.Timeout:
+		return TimeoutCategory
+	case event.Response >= 500:
+		return ServerErrorCategory
+	case slow > 0 && event.Latency > slow:
+		return SlowCategory
+	}
+	return ""
+}
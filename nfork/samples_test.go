@@ -0,0 +1,88 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package nfork
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestErrorRing(t *testing.T) {
+	ring := &ErrorRing{Size: 3}
+
+	ExpectPaths := func(title string, exp ...string) {
+		samples := ring.Read()
+		if len(samples) != len(exp) {
+			t.Errorf("FAIL(%s): unexpected samples -> %d != %d", title, len(samples), len(exp))
+			return
+		}
+
+		for i, path := range exp {
+			if samples[i].Path != path {
+				t.Errorf("FAIL(%s): unexpected sample %d -> %s != %s", title, i, samples[i].Path, path)
+			}
+		}
+	}
+
+	ExpectPaths("empty")
+
+	ring.Add(&ErrorSample{Path: "/a"})
+	ring.Add(&ErrorSample{Path: "/b"})
+	ExpectPaths("partial", "/a", "/b")
+
+	ring.Add(&ErrorSample{Path: "/c"})
+	ring.Add(&ErrorSample{Path: "/d"})
+	ring.Add(&ErrorSample{Path: "/e"})
+	ExpectPaths("wrapped", "/c", "/d", "/e")
+}
+
+func TestSampleCategory(t *testing.T) {
+	slow := 100 * time.Millisecond
+
+	for _, test := range []struct {
+		event Event
+		exp   string
+	}{
+		{Event{Error: true}, ErrorCategory},
+		{Event{Timeout: true}, TimeoutCategory},
+		{Event{Response: 503, Latency: time.Millisecond}, ServerErrorCategory},
+		{Event{Response: 200, Latency: 200 * time.Millisecond}, SlowCategory},
+		{Event{Response: 404, Latency: time.Millisecond}, ""},
+	} {
+		if category := sampleCategory(test.event, slow); category != test.exp {
+			t.Errorf("FAIL(%+v): unexpected category -> '%s' != '%s'", test.event, category, test.exp)
+		}
+	}
+}
+
+func TestErrorSampleJSON(t *testing.T) {
+	sample := &ErrorSample{
+		Time:      time.Date(2014, 6, 1, 12, 0, 0, 0, time.UTC),
+		Method:    "GET",
+		Path:      "/a",
+		Category:  TimeoutCategory,
+		Latency:   1234567 * time.Microsecond,
+		Error:     "timeout",
+		RequestID: "r0",
+	}
+
+	body, err := json.Marshal(sample)
+	if err != nil {
+		t.Fatalf("FAIL: unable to marshal -> %s", err)
+	}
+
+	decoded := new(ErrorSample)
+	if err := json.Unmarshal(body, decoded); err != nil {
+		t.Fatalf("FAIL: unable to unmarshal -> %s", err)
+	}
+
+	if !decoded.Time.Equal(sample.Time) {
+		t.Errorf("FAIL: unexpected time -> %s", decoded.Time)
+	}
+
+	decoded.Time = sample.Time
+	if *decoded != *sample {
+		t.Errorf("FAIL: unexpected sample -> %+v != %+v", decoded, sample)
+	}
+}
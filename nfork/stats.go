@@ -4,7 +4,7 @@ package nfork
 
 import (
 	"encoding/json"
-	"math/rand"
+	"fmt"
 	"strconv"
 	"sync"
 	"time"
@@ -22,15 +22,231 @@ type Stats struct {
 	// Timeouts counts the number of timeouts encountered.
 	Timeouts uint64
 
+	// BodyErrors counts the number of requests whose body couldn't be read.
+	// Only set for inbounds.
+	BodyErrors uint64
+
+	// Failures counts the number of requests where the active outbound
+	// failed. Only set for inbounds.
+	Failures uint64
+
 	// Latency is the latency distribution of all requests.
-	Latency Distribution
+	Latency Histogram
+
+	// ClassLatency is the latency distribution of requests grouped by outcome
+	// which is either the class of the HTTP status code (eg. 2xx), ErrorClass
+	// or TimeoutClass.
+	ClassLatency map[string]*Histogram
 
 	// Responses counts the number of responses received for an HTTP status
 	// code.
 	Responses map[int]uint64
+
+	// RequestBytes counts the number of bytes sent in request bodies.
+	RequestBytes uint64
+
+	// ResponseBytes counts the number of bytes received in response bodies.
+	ResponseBytes uint64
+
+	// RequestSize is the size distribution of all request bodies.
+	RequestSize Histogram
+
+	// ResponseSize is the size distribution of all response bodies.
+	ResponseSize Histogram
+
+	// Routes contains the stats of the requests grouped by route. See
+	// Inbound.Routes.
+	Routes map[string]*Stats
+
+	// Comparison compares the latency of the outbound with the latency of the
+	// active outbound. Only set for shadow outbounds.
+	Comparison *Comparison
+
+	// Connection contains the connection timings of the requests. Only set
+	// for outbounds.
+	Connection *ConnectionStats
+}
+
+// InboundStats contains the stats of an inbound and of each of its outbounds.
+//
+// The stats of the inbound measure the requests as seen by the client: Latency
+// is the end-to-end latency, Responses counts the HTTP status codes sent back
+// to the client, BodyErrors counts the requests whose body couldn't be read
+// and Failures counts the requests where the active outbound failed.
+type InboundStats struct {
+
+	// Inbound contains the stats of the requests received by the inbound.
+	Inbound *Stats `json:"inbound"`
+
+	// InFlight is the number of requests currently being processed.
+	InFlight int64 `json:"inFlight"`
+
+	// Outbounds contains the stats of each outbounds.
+	Outbounds map[string]*Stats `json:"outbounds"`
+}
+
+// InboundHistory contains the stats history of an inbound and of each of its
+// outbounds. See StatsRecorder.ReadHistory.
+type InboundHistory struct {
+	Inbound   []*StatsSample            `json:"inbound"`
+	Outbounds map[string][]*StatsSample `json:"outbounds"`
+}
+
+// Outcome classes used in Stats.ClassLatency for requests without responses.
+const (
+	ErrorClass   = "error"
+	TimeoutClass = "timeout"
+)
+
+// Class returns the outcome class of the event.
+func (event Event) Class() string {
+	if event.Error {
+		return ErrorClass
+	}
+	if event.Timeout {
+		return TimeoutClass
+	}
+	return fmt.Sprintf("%dxx", event.Response/100)
 }
 
-// MarshalJSON defines a custom JSON format for encoding/json.
+// Outcome returns the HTTP status code of the event or either ErrorClass or
+// TimeoutClass if no response was received.
+func (event Event) Outcome() string {
+	if event.Error {
+		return ErrorClass
+	}
+	if event.Timeout {
+		return TimeoutClass
+	}
+	return strconv.Itoa(event.Response)
+}
+
+// Copy returns a deep copy of the stats.
+func (stats *Stats) Copy() *Stats {
+	newStats := &Stats{
+		Requests: stats.Requests,
+		Errors:   stats.Errors,
+		Timeouts: stats.Timeouts,
+		Latency:  stats.Latency.Copy(),
+
+		BodyErrors: stats.BodyErrors,
+		Failures:   stats.Failures,
+
+		RequestBytes:  stats.RequestBytes,
+		ResponseBytes: stats.ResponseBytes,
+		RequestSize:   stats.RequestSize.Copy(),
+		ResponseSize:  stats.ResponseSize.Copy(),
+	}
+
+	if stats.Responses != nil {
+		newStats.Responses = make(map[int]uint64)
+		for code, count := range stats.Responses {
+			newStats.Responses[code] = count
+		}
+	}
+
+	if stats.ClassLatency != nil {
+		newStats.ClassLatency = make(map[string]*Histogram)
+		for class, hist := range stats.ClassLatency {
+			newHist := hist.Copy()
+			newStats.ClassLatency[class] = &newHist
+		}
+	}
+
+	if stats.Routes != nil {
+		newStats.Routes = make(map[string]*Stats)
+		for route, routeStats := range stats.Routes {
+			newStats.Routes[route] = routeStats.Copy()
+		}
+	}
+
+	if stats.Comparison != nil {
+		newStats.Comparison = stats.Comparison.Copy()
+	}
+
+	if stats.Connection != nil {
+		newStats.Connection = stats.Connection.Copy()
+	}
+
+	return newStats
+}
+
+// Merge adds the stats of other to the stats.
+func (stats *Stats) Merge(other *Stats) {
+	stats.Requests += other.Requests
+	stats.Errors += other.Errors
+	stats.Timeouts += other.Timeouts
+	stats.Latency.Merge(&other.Latency)
+
+	stats.BodyErrors += other.BodyErrors
+	stats.Failures += other.Failures
+
+	stats.RequestBytes += other.RequestBytes
+	stats.ResponseBytes += other.ResponseBytes
+	stats.RequestSize.Merge(&other.RequestSize)
+	stats.ResponseSize.Merge(&other.ResponseSize)
+
+	for code, count := range other.Responses {
+		if stats.Responses == nil {
+			stats.Responses = make(map[int]uint64)
+		}
+		stats.Responses[code] += count
+	}
+
+	for class, hist := range other.ClassLatency {
+		stats.classLatency(class).Merge(hist)
+	}
+
+	for route, routeStats := range other.Routes {
+		stats.route(route).Merge(routeStats)
+	}
+
+	if other.Comparison != nil {
+		if stats.Comparison == nil {
+			stats.Comparison = new(Comparison)
+		}
+		stats.Comparison.Merge(other.Comparison)
+	}
+
+	if other.Connection != nil {
+		if stats.Connection == nil {
+			stats.Connection = new(ConnectionStats)
+		}
+		stats.Connection.Merge(other.Connection)
+	}
+}
+
+func (stats *Stats) route(route string) *Stats {
+	if stats.Routes == nil {
+		stats.Routes = make(map[string]*Stats)
+	}
+
+	routeStats, ok := stats.Routes[route]
+	if !ok {
+		routeStats = new(Stats)
+		stats.Routes[route] = routeStats
+	}
+
+	return routeStats
+}
+
+func (stats *Stats) classLatency(class string) *Histogram {
+	if stats.ClassLatency == nil {
+		stats.ClassLatency = make(map[string]*Histogram)
+	}
+
+	hist, ok := stats.ClassLatency[class]
+	if !ok {
+		hist = new(Histogram)
+		stats.ClassLatency[class] = hist
+	}
+
+	return hist
+}
+
+// MarshalJSON defines a custom JSON format for encoding/json. The percentiles
+// of each distribution are provided for convenience while the distributions
+// themselves are kept under histograms.
 func (stats *Stats) MarshalJSON() ([]byte, error) {
 	var statsJSON struct {
 		Requests  uint64            `json:"requests"`
@@ -38,19 +254,57 @@ func (stats *Stats) MarshalJSON() ([]byte, error) {
 		Timeouts  uint64            `json:"timeouts"`
 		Latency   map[string]string `json:"latency"`
 		Responses map[string]uint64 `json:"responses"`
+
+		BodyErrors uint64 `json:"bodyErrors,omitempty"`
+		Failures   uint64 `json:"failures,omitempty"`
+
+		ClassLatency map[string]map[string]string `json:"classLatency,omitempty"`
+
+		RequestBytes  uint64            `json:"requestBytes"`
+		ResponseBytes uint64            `json:"responseBytes"`
+		RequestSize   map[string]uint64 `json:"requestSize"`
+		ResponseSize  map[string]uint64 `json:"responseSize"`
+
+		Routes map[string]*Stats `json:"routes,omitempty"`
+
+		Comparison *Comparison      `json:"comparison,omitempty"`
+		Connection *ConnectionStats `json:"connection,omitempty"`
+
+		Histograms struct {
+			Latency      *Histogram            `json:"latency"`
+			ClassLatency map[string]*Histogram `json:"classLatency,omitempty"`
+			RequestSize  *Histogram            `json:"requestSize"`
+			ResponseSize *Histogram            `json:"responseSize"`
+		} `json:"histograms"`
 	}
 
 	statsJSON.Requests = stats.Requests
 	statsJSON.Errors = stats.Errors
 	statsJSON.Timeouts = stats.Timeouts
-	statsJSON.Latency = make(map[string]string)
+	statsJSON.BodyErrors = stats.BodyErrors
+	statsJSON.Failures = stats.Failures
+	statsJSON.Latency = latencyJSON(&stats.Latency)
 	statsJSON.Responses = make(map[string]uint64)
 
-	p50, p90, p99, max := stats.Latency.Percentiles()
-	statsJSON.Latency["p50"] = time.Duration(p50).String()
-	statsJSON.Latency["p90"] = time.Duration(p90).String()
-	statsJSON.Latency["p99"] = time.Duration(p99).String()
-	statsJSON.Latency["pmx"] = time.Duration(max).String()
+	statsJSON.RequestBytes = stats.RequestBytes
+	statsJSON.ResponseBytes = stats.ResponseBytes
+	statsJSON.RequestSize = sizeJSON(&stats.RequestSize)
+	statsJSON.ResponseSize = sizeJSON(&stats.ResponseSize)
+	statsJSON.Routes = stats.Routes
+	statsJSON.Comparison = stats.Comparison
+	statsJSON.Connection = stats.Connection
+
+	statsJSON.Histograms.Latency = &stats.Latency
+	statsJSON.Histograms.RequestSize = &stats.RequestSize
+	statsJSON.Histograms.ResponseSize = &stats.ResponseSize
+
+	if len(stats.ClassLatency) > 0 {
+		statsJSON.ClassLatency = make(map[string]map[string]string)
+		statsJSON.Histograms.ClassLatency = stats.ClassLatency
+		for class, hist := range stats.ClassLatency {
+			statsJSON.ClassLatency[class] = latencyJSON(hist)
+		}
+	}
 
 	for code, count := range stats.Responses {
 		statsJSON.Responses[strconv.Itoa(code)] = count
@@ -59,6 +313,83 @@ func (stats *Stats) MarshalJSON() ([]byte, error) {
 	return json.Marshal(&statsJSON)
 }
 
+// UnmarshalJSON defines a custom JSON format for encoding/json. The
+// distributions are decoded from histograms and the percentiles, which are
+// derived from them, are ignored.
+func (stats *Stats) UnmarshalJSON(body []byte) (err error) {
+	var statsJSON struct {
+		Requests  uint64            `json:"requests"`
+		Errors    uint64            `json:"errors"`
+		Timeouts  uint64            `json:"timeouts"`
+		Responses map[string]uint64 `json:"responses"`
+
+		BodyErrors uint64 `json:"bodyErrors"`
+		Failures   uint64 `json:"failures"`
+
+		RequestBytes  uint64 `json:"requestBytes"`
+		ResponseBytes uint64 `json:"responseBytes"`
+
+		Routes map[string]*Stats `json:"routes"`
+
+		Comparison *Comparison      `json:"comparison"`
+		Connection *ConnectionStats `json:"connection"`
+
+		Histograms struct {
+			Latency      Histogram             `json:"latency"`
+			ClassLatency map[string]*Histogram `json:"classLatency"`
+			RequestSize  Histogram             `json:"requestSize"`
+			ResponseSize Histogram             `json:"responseSize"`
+		} `json:"histograms"`
+	}
+
+	if err = json.Unmarshal(body, &statsJSON); err != nil {
+		return
+	}
+
+	stats.Requests = statsJSON.Requests
+	stats.Errors = statsJSON.Errors
+	stats.Timeouts = statsJSON.Timeouts
+	stats.BodyErrors = statsJSON.BodyErrors
+	stats.Failures = statsJSON.Failures
+	stats.Latency = statsJSON.Histograms.Latency
+	stats.ClassLatency = statsJSON.Histograms.ClassLatency
+
+	stats.RequestBytes = statsJSON.RequestBytes
+	stats.ResponseBytes = statsJSON.ResponseBytes
+	stats.RequestSize = statsJSON.Histograms.RequestSize
+	stats.ResponseSize = statsJSON.Histograms.ResponseSize
+	stats.Routes = statsJSON.Routes
+	stats.Comparison = statsJSON.Comparison
+	stats.Connection = statsJSON.Connection
+
+	stats.Responses = make(map[int]uint64)
+	for code, count := range statsJSON.Responses {
+		value, err := strconv.Atoi(code)
+		if err != nil {
+			return fmt.Errorf("invalid response code '%s'", code)
+		}
+		stats.Responses[value] = count
+	}
+
+	return
+}
+
+func sizeJSON(hist *Histogram) map[string]uint64 {
+	p50, p90, p99, max := hist.Percentiles()
+	return map[string]uint64{"p50": p50, "p90": p90, "p99": p99, "pmx": max}
+}
+
+func latencyJSON(hist *Histogram) map[string]string {
+	p50, p90, p99, max := hist.Percentiles()
+
+	return map[string]string{
+		"p50": time.Duration(p50).String(),
+		"p90": time.Duration(p90).String(),
+		"p99": time.Duration(p99).String(),
+		"pmx": time.Duration(max).String(),
+	}
+}
+
 // Event contains the outcome of an HTTP request.
 type Event struct {
 
@@ -68,16 +399,51 @@ type Event struct {
 	// Timeout indicates that the request timed out.
 	Timeout bool
 
+	// BodyError indicates that the body of the request received by an inbound
+	// couldn't be read.
+	BodyError bool
+
+	// Failed indicates that the active outbound failed to respond to the
+	// request received by an inbound.
+	Failed bool
+
 	// Response is the HTTP response code received.
 	Response int
 
 	// Latency mesures the latency of the request.
 	Latency time.Duration
+
+	// RequestBytes is the size of the request body.
+	RequestBytes int
+
+	// ResponseBytes is the size of the response body.
+	ResponseBytes int
+
+	// Route is the route matched by the request or empty if the inbound has
+	// no routes.
+	Route string
+
+	// Connection contains the connection timings of the request.
+	Connection ConnectionTrace
 }
 
 // DefaultSampleRate is used if Rate is not set set in StatsRecorder.
 const DefaultSampleRate = 1 * time.Second
 
+// DefaultStatsWindows is used if Windows is not set in StatsRecorder.
+var DefaultStatsWindows = []time.Duration{1 * time.Minute, 5 * time.Minute, 1 * time.Hour}
+
+// StatsWindowBuckets is the maximum number of buckets making up each of the
+// Windows of a StatsRecorder.
+const StatsWindowBuckets = 60
+
+// DefaultStatsHistory is used if History is not set in StatsRecorder.
+const DefaultStatsHistory = 600
+
+// TotalWindow is the name of the window containing the stats accumulated since
+// the creation of a StatsRecorder.
+const TotalWindow = "total"
+
 // StatsRecorder records stats for a given outbound and updates them at a
 // given rate.
 type StatsRecorder struct {
@@ -85,17 +451,84 @@ type StatsRecorder struct {
 	// Rate at which stats are updated.
 	Rate time.Duration
 
-	// Rand is the RNG used for stats sampling.
-	Rand *rand.Rand
+	// Windows are additional rolling periods over which stats are aggregated.
+	// Each window is split in up to StatsWindowBuckets buckets whose length is
+	// rounded down to a multiple of Rate. A window always covers its most
+	// recent buckets and is updated every time a bucket is completed.
+	Windows []time.Duration
+
+	// SlowerThreshold is the latency difference above which the outbound is
+	// considered slower than the active outbound. See Comparison.
+	SlowerThreshold time.Duration
+
+	// History is the number of past Rate windows kept by the recorder. See
+	// ReadHistory. Defaults to DefaultStatsHistory and can be disabled by
+	// setting it to a negative value.
+	History int
+
+	// Publish is an optional callback invoked with the newly updated stats
+	// every time the stats are updated.
+	Publish func(*Stats)
 
 	initialize sync.Once
 
 	mutex         sync.Mutex
 	current, prev *Stats
+	total         *Stats
+	windows       []*statsWindow
+
+	history     []*StatsSample
+	historyNext int
 
+	shutdown  sync.Once
 	shutdownC chan int
 }
 
+// StatsSample is the stats of a single Rate window along with the time at
+// which the window ended.
+type StatsSample struct {
+	Time  time.Time `json:"time"`
+	Stats *Stats    `json:"stats"`
+}
+
+type statsWindow struct {
+	length time.Duration
+
+	// ticks is the number of Rate periods in each bucket.
+	ticks uint64
+
+	current *Stats
+	buckets []*Stats
+	next    int
+
+	// merged caches the stats of all the completed buckets. It's computed on
+	// read and cleared every time the buckets change.
+	merged *Stats
+
+	// generation is incremented every time the buckets change so that a
+	// merge computed from older buckets isn't cached.
+	generation uint64
+}
+
+func (window *statsWindow) reset() {
+	window.current = new(Stats)
+	window.buckets = make([]*Stats, len(window.buckets))
+	window.next = 0
+	window.merged = nil
+	window.generation++
+}
+
+// rotate completes the current bucket and replaces the oldest bucket with it.
+// Completed buckets are never modified so they can be merged without holding
+// the lock of the recorder.
+func (window *statsWindow) rotate() {
+	window.buckets[window.next] = window.current
+	window.next = (window.next + 1) % len(window.buckets)
+	window.current = new(Stats)
+	window.merged = nil
+	window.generation++
+}
+
 // Init initializes the object.
 func (recorder *StatsRecorder) Init() {
 	recorder.initialize.Do(recorder.init)
@@ -106,21 +539,52 @@ func (recorder *StatsRecorder) init() {
 		recorder.Rate = DefaultSampleRate
 	}
 
-	if recorder.Rand == nil {
-		recorder.Rand = rand.New(rand.NewSource(0))
-	}
-
 	recorder.prev = new(Stats)
 	recorder.current = new(Stats)
+	recorder.total = new(Stats)
+
+	if recorder.SlowerThreshold == 0 {
+		recorder.SlowerThreshold = DefaultSlowerThreshold
+	}
+
+	if recorder.Windows == nil {
+		recorder.Windows = DefaultStatsWindows
+	}
+
+	if recorder.History == 0 {
+		recorder.History = DefaultStatsHistory
+	}
+
+	for _, length := range recorder.Windows {
+		ticks := uint64(length / recorder.Rate)
+		if ticks == 0 {
+			ticks = 1
+		}
+
+		buckets := uint64(StatsWindowBuckets)
+		if ticks < buckets {
+			buckets = ticks
+		}
+
+		window := &statsWindow{
+			length:  length,
+			ticks:   ticks / buckets,
+			buckets: make([]*Stats, buckets),
+		}
+		window.reset()
+		recorder.windows = append(recorder.windows, window)
+	}
 
 	recorder.shutdownC = make(chan int)
 	go recorder.run()
 }
 
-// Close terminates the stats recorder.
+// Close terminates the stats recorder. Stats can still be recorded and read
+// after the recorder is closed but they're no longer updated. Calling Close
+// more than once has no effects.
 func (recorder *StatsRecorder) Close() {
 	recorder.Init()
-	recorder.shutdownC <- 1
+	recorder.shutdown.Do(func() { close(recorder.shutdownC) })
 }
 
 // Record records the given outcome.
@@ -128,10 +592,73 @@ func (recorder *StatsRecorder) Record(event Event) {
 	recorder.Init()
 	recorder.mutex.Lock()
 
-	stats := recorder.current
+	recorder.current.record(event)
+	recorder.total.record(event)
+
+	for _, window := range recorder.windows {
+		window.current.record(event)
+	}
+
+	recorder.mutex.Unlock()
+}
+
+// RecordComparison records how the outcome of a request to this outbound
+// compares to the outcome of the same request to the active outbound.
+func (recorder *StatsRecorder) RecordComparison(active, shadow Event) {
+	recorder.Init()
+	recorder.mutex.Lock()
+
+	recorder.current.recordComparison(active, shadow, recorder.SlowerThreshold)
+	recorder.total.recordComparison(active, shadow, recorder.SlowerThreshold)
+
+	for _, window := range recorder.windows {
+		window.current.recordComparison(active, shadow, recorder.SlowerThreshold)
+	}
+
+	recorder.mutex.Unlock()
+}
+
+func (stats *Stats) recordComparison(active, shadow Event, threshold time.Duration) {
+	if stats.Comparison == nil {
+		stats.Comparison = &Comparison{Threshold: threshold}
+	}
+	stats.Comparison.record(active, shadow)
+}
+
+func (stats *Stats) record(event Event) {
+	if len(event.Route) > 0 {
+		routeEvent := event
+		routeEvent.Route = ""
+		routeEvent.Connection = ConnectionTrace{}
+		stats.route(event.Route).record(routeEvent)
+	}
+
+	if event.Connection.Obtained {
+		if stats.Connection == nil {
+			stats.Connection = new(ConnectionStats)
+		}
+		stats.Connection.record(event.Connection)
+	}
 
 	stats.Requests++
 	stats.Latency.Sample(uint64(event.Latency))
+	stats.classLatency(event.Class()).Sample(uint64(event.Latency))
+
+	stats.RequestBytes += uint64(event.RequestBytes)
+	stats.RequestSize.Sample(uint64(event.RequestBytes))
+
+	if !event.Error && !event.Timeout {
+		stats.ResponseBytes += uint64(event.ResponseBytes)
+		stats.ResponseSize.Sample(uint64(event.ResponseBytes))
+	}
+
+	if event.BodyError {
+		stats.BodyErrors++
+	}
+
+	if event.Failed {
+		stats.Failures++
+	}
 
 	if event.Error {
 		stats.Errors++
@@ -145,8 +672,6 @@ func (recorder *StatsRecorder) Record(event Event) {
 		}
 		stats.Responses[event.Response]++
 	}
-
-	recorder.mutex.Unlock()
 }
 
 // Read returns the last updated stats.
@@ -160,18 +685,156 @@ func (recorder *StatsRecorder) Read() (stats *Stats) {
 	return
 }
 
+// ReadTotal returns the stats accumulated since the recorder was created.
+func (recorder *StatsRecorder) ReadTotal() (stats *Stats) {
+	recorder.Init()
+	recorder.mutex.Lock()
+
+	stats = recorder.total.Copy()
+
+	recorder.mutex.Unlock()
+	return
+}
+
+// ReadWindow returns the last updated stats of the given window. The window
+// is either a duration matching Rate or one of the Windows, or TotalWindow.
+// An empty window is equivalent to Rate.
+func (recorder *StatsRecorder) ReadWindow(window string) (*Stats, error) {
+	recorder.Init()
+
+	if len(window) == 0 {
+		return recorder.Read(), nil
+	}
+
+	if window == TotalWindow {
+		return recorder.ReadTotal(), nil
+	}
+
+	length, err := time.ParseDuration(window)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stats window '%s': %s", window, err)
+	}
+
+	if length == recorder.Rate {
+		return recorder.Read(), nil
+	}
+
+	for _, win := range recorder.windows {
+		if win.length == length {
+			return recorder.readWindow(win), nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown stats window '%s'", window)
+}
+
+// readWindow merges the completed buckets of the window outside of the lock
+// to avoid blocking Record and caches the result until the next rotation.
+func (recorder *StatsRecorder) readWindow(window *statsWindow) *Stats {
+	recorder.mutex.Lock()
+
+	if merged := window.merged; merged != nil {
+		recorder.mutex.Unlock()
+		return merged
+	}
+
+	buckets := append([]*Stats(nil), window.buckets...)
+	generation := window.generation
+
+	recorder.mutex.Unlock()
+
+	merged := new(Stats)
+	for _, bucket := range buckets {
+		if bucket != nil {
+			merged.Merge(bucket)
+		}
+	}
+
+	recorder.mutex.Lock()
+	if window.generation == generation {
+		window.merged = merged
+	}
+	recorder.mutex.Unlock()
+
+	return merged
+}
+
+// Reset discards all the stats recorded so far including the windows, the
+// accumulated total and the history.
+func (recorder *StatsRecorder) Reset() {
+	recorder.Init()
+	recorder.mutex.Lock()
+
+	recorder.prev = new(Stats)
+	recorder.current = new(Stats)
+	recorder.total = new(Stats)
+
+	for _, window := range recorder.windows {
+		window.reset()
+	}
+
+	recorder.history = nil
+	recorder.historyNext = 0
+
+	recorder.mutex.Unlock()
+}
+
+// ReadHistory returns the stats of the last History windows ordered from the
+// oldest to the most recent.
+func (recorder *StatsRecorder) ReadHistory() []*StatsSample {
+	recorder.Init()
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	history := make([]*StatsSample, 0, len(recorder.history))
+	if len(recorder.history) == recorder.History {
+		history = append(history, recorder.history[recorder.historyNext:]...)
+		history = append(history, recorder.history[:recorder.historyNext]...)
+	} else {
+		history = append(history, recorder.history...)
+	}
+
+	return history
+}
+
+func (recorder *StatsRecorder) appendHistory(sample *StatsSample) {
+	if recorder.History <= 0 {
+		return
+	}
+
+	if len(recorder.history) < recorder.History {
+		recorder.history = append(recorder.history, sample)
+		return
+	}
+
+	recorder.history[recorder.historyNext] = sample
+	recorder.historyNext = (recorder.historyNext + 1) % recorder.History
+}
+
 func (recorder *StatsRecorder) run() {
 	tick := time.NewTicker(recorder.Rate)
-	for {
+	for ticks := uint64(1); ; ticks++ {
 		select {
-		case <-tick.C:
+		case now := <-tick.C:
 			recorder.mutex.Lock()
 
 			recorder.prev = recorder.current
 			recorder.current = new(Stats)
+			stats := recorder.prev
+			recorder.appendHistory(&StatsSample{Time: now, Stats: stats})
+
+			for _, window := range recorder.windows {
+				if ticks%window.ticks == 0 {
+					window.rotate()
+				}
+			}
 
 			recorder.mutex.Unlock()
 
+			if recorder.Publish != nil {
+				recorder.Publish(stats)
+			}
+
 		case <-recorder.shutdownC:
 			tick.Stop()
 			return
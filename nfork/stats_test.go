@@ -0,0 +1,170 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package nfork
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestStatsRecorderWindows(t *testing.T) {
+	recorder := &StatsRecorder{
+		Rate:    10 * time.Millisecond,
+		Windows: []time.Duration{50 * time.Millisecond},
+	}
+	defer recorder.Close()
+
+	for i := 0; i < 5; i++ {
+		recorder.Record(Event{Response: 200, Latency: time.Millisecond})
+	}
+
+	ExpectRequests := func(title, window string, exp uint64) {
+		stats, err := recorder.ReadWindow(window)
+		if err != nil {
+			t.Errorf("FAIL(%s.%s): unable to read window -> %s", title, window, err)
+		} else if stats.Requests != exp {
+			t.Errorf("FAIL(%s.%s): unexpected requests -> %d != %d", title, window, stats.Requests, exp)
+		}
+	}
+
+	time.Sleep(25 * time.Millisecond)
+
+	ExpectRequests("rolling", "", 0)
+	ExpectRequests("rolling", "10ms", 0)
+	ExpectRequests("rolling", "50ms", 5)
+	ExpectRequests("rolling", TotalWindow, 5)
+
+	time.Sleep(75 * time.Millisecond)
+
+	ExpectRequests("expired", "50ms", 0)
+	ExpectRequests("expired", TotalWindow, 5)
+
+	if _, err := recorder.ReadWindow("1h"); err == nil {
+		t.Errorf("FAIL(1h): expected unknown window error")
+	}
+}
+
+func TestStatsRecorderHistory(t *testing.T) {
+	recorder := &StatsRecorder{Rate: 10 * time.Millisecond, History: 5}
+	defer recorder.Close()
+
+	for i := 0; i < 3; i++ {
+		recorder.Record(Event{Response: 200, Latency: time.Millisecond})
+	}
+
+	time.Sleep(25 * time.Millisecond)
+
+	history := recorder.ReadHistory()
+	if len(history) == 0 || history[0].Stats.Requests != 3 {
+		t.Errorf("FAIL: unexpected first window -> %v", history)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	history = recorder.ReadHistory()
+	if len(history) != 5 {
+		t.Fatalf("FAIL: unexpected history length -> %d != 5", len(history))
+	}
+
+	for i := 1; i < len(history); i++ {
+		if !history[i-1].Time.Before(history[i].Time) {
+			t.Errorf("FAIL: history out of order at %d -> %s >= %s", i, history[i-1].Time, history[i].Time)
+		}
+		if history[i].Stats.Requests != 0 {
+			t.Errorf("FAIL: unexpected requests at %d -> %d", i, history[i].Stats.Requests)
+		}
+	}
+}
+
+func TestStatsRecorderClose(t *testing.T) {
+	n := runtime.NumGoroutine()
+
+	recorder := &StatsRecorder{Rate: 10 * time.Millisecond}
+	recorder.Init()
+	recorder.Close()
+	recorder.Close()
+
+	ExpectGoroutines(t, "close", n)
+}
+
+func TestStatsJSON(t *testing.T) {
+	stats := new(Stats)
+
+	for i := 0; i < 1000; i++ {
+		latency := time.Duration(rand.Int63n(int64(100 * time.Millisecond)))
+
+		event := Event{
+			Response:      []int{200, 200, 200, 404, 503}[i%5],
+			Latency:       latency,
+			Route:         []string{"/a", "/b"}[i%2],
+			RequestBytes:  rand.Intn(10000),
+			ResponseBytes: rand.Intn(10000),
+			Connection: ConnectionTrace{
+				Obtained:  true,
+				Reused:    i%3 != 0,
+				Connect:   time.Duration(rand.Int63n(int64(time.Millisecond))),
+				FirstByte: latency / 2,
+			},
+		}
+
+		switch i % 50 {
+		case 0:
+			event.Error = true
+		case 1:
+			event.Timeout = true
+		}
+
+		stats.record(event)
+		stats.recordComparison(Event{Response: 200, Latency: latency / 2}, event, 10*time.Millisecond)
+	}
+
+	body, err := json.Marshal(stats)
+	if err != nil {
+		t.Fatalf("FAIL: unable to marshal -> %s", err)
+	}
+
+	decoded := new(Stats)
+	if err := json.Unmarshal(body, decoded); err != nil {
+		t.Fatalf("FAIL: unable to unmarshal -> %s", err)
+	}
+
+	if newBody, err := json.Marshal(decoded); err != nil {
+		t.Fatalf("FAIL: unable to marshal decoded stats -> %s", err)
+	} else if !bytes.Equal(body, newBody) {
+		t.Errorf("FAIL: JSON doesn't round-trip\n%s\n%s", body, newBody)
+	}
+
+	if decoded.Requests != stats.Requests || decoded.Responses[503] != stats.Responses[503] {
+		t.Errorf("FAIL: unexpected counts -> %+v", decoded)
+	}
+
+	if decoded.Latency.Count != stats.Latency.Count || decoded.Latency.Sum != stats.Latency.Sum {
+		t.Errorf("FAIL: unexpected latency count -> %d != %d", decoded.Latency.Count, stats.Latency.Count)
+	}
+
+	ExpectHistogram := func(title string, hist, exp *Histogram) {
+		if !reflect.DeepEqual(hist, exp) {
+			t.Errorf("FAIL(%s): histogram doesn't round-trip -> %+v != %+v", title, hist, exp)
+		}
+	}
+
+	ExpectHistogram("latency", &decoded.Latency, &stats.Latency)
+	ExpectHistogram("latency.4xx", decoded.ClassLatency["4xx"], stats.ClassLatency["4xx"])
+	ExpectHistogram("size.request", &decoded.RequestSize, &stats.RequestSize)
+	ExpectHistogram("size.response", &decoded.ResponseSize, &stats.ResponseSize)
+	ExpectHistogram("route.latency", &decoded.Routes["/a"].Latency, &stats.Routes["/a"].Latency)
+	ExpectHistogram("comparison.slower", &decoded.Comparison.Slower, &stats.Comparison.Slower)
+	ExpectHistogram("connection.firstByte", &decoded.Connection.FirstByte, &stats.Connection.FirstByte)
+
+	if err := json.Unmarshal([]byte(`{"histograms": {"latency": {"count": 1, "buckets": [[65, 1]]}}}`), new(Stats)); err == nil {
+		t.Errorf("FAIL: expected invalid bucket error")
+	}
+	if err := json.Unmarshal([]byte(`{"histograms": {"latency": {"count": 2, "buckets": [[64, 1]]}}}`), new(Stats)); err == nil {
+		t.Errorf("FAIL: expected invalid count error")
+	}
+}
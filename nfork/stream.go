@@ -0,0 +1,193 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package nfork
+
+import (
+	"github.com/datacratic/goklog/klog"
+
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DefaultStreamBuffer is the number of stats snapshots that can be queued for
+// a stream subscriber before snapshots are dropped.
+const DefaultStreamBuffer = 16
+
+// StreamEvent is a stats snapshot of an inbound sent to the stream
+// subscribers every time the stats of the inbound are updated.
+type StreamEvent struct {
+	Inbound string        `json:"inbound"`
+	Stats   *InboundStats `json:"stats"`
+}
+
+// statsStream fans out the stats snapshots of the inbounds managed by a
+// controller to a set of subscribers. Notifications come from the stats
+// recorders and are processed asynchronously to avoid having the recorders
+// wait on the controller.
+type statsStream struct {
+	control *Controller
+
+	mutex       sync.Mutex
+	subscribers map[*streamSubscriber]struct{}
+
+	notifyC   chan string
+	shutdown  sync.Once
+	shutdownC chan int
+}
+
+type streamSubscriber struct {
+	inbound string
+	eventC  chan []byte
+}
+
+func newStatsStream(control *Controller) *statsStream {
+	stream := &statsStream{
+		control:     control,
+		subscribers: make(map[*streamSubscriber]struct{}),
+		notifyC:     make(chan string, 64),
+		shutdownC:   make(chan int),
+	}
+
+	go stream.run()
+	return stream
+}
+
+func (stream *statsStream) close() {
+	stream.shutdown.Do(func() { close(stream.shutdownC) })
+}
+
+// notify signals that the stats of the given inbound were updated. It never
+// blocks.
+func (stream *statsStream) notify(inbound string) {
+	select {
+	case stream.notifyC <- inbound:
+	default:
+	}
+}
+
+func (stream *statsStream) subscribe(inbound string) *streamSubscriber {
+	sub := &streamSubscriber{inbound: inbound, eventC: make(chan []byte, DefaultStreamBuffer)}
+
+	stream.mutex.Lock()
+	stream.subscribers[sub] = struct{}{}
+	stream.mutex.Unlock()
+
+	return sub
+}
+
+func (stream *statsStream) unsubscribe(sub *streamSubscriber) {
+	stream.mutex.Lock()
+	delete(stream.subscribers, sub)
+	stream.mutex.Unlock()
+}
+
+func (stream *statsStream) run() {
+	for {
+		select {
+		case inbound := <-stream.notifyC:
+			stream.publish(inbound)
+
+		case <-stream.shutdownC:
+			return
+		}
+	}
+}
+
+func (stream *statsStream) publish(inbound string) {
+	stream.mutex.Lock()
+	empty := len(stream.subscribers) == 0
+	stream.mutex.Unlock()
+
+	if empty {
+		return
+	}
+
+	stats, err := stream.control.ReadInboundStats(inbound)
+	if err != nil {
+		return
+	}
+
+	body, err := json.Marshal(&StreamEvent{Inbound: inbound, Stats: stats})
+	if err != nil {
+		klog.KPrintf("stream.error", "unable to marshal stats for '%s': %s", inbound, err)
+		return
+	}
+
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+
+	for sub := range stream.subscribers {
+		if len(sub.inbound) > 0 && sub.inbound != inbound {
+			continue
+		}
+
+		select {
+		case sub.eventC <- body:
+		default:
+		}
+	}
+}
+
+// ServeStream streams the stats snapshots of the given inbound, or of all the
+// inbounds if empty, as Server-Sent Events until the client disconnects. A
+// snapshot is sent every time the stats of an inbound are updated.
+func (control *Controller) ServeStream(writer http.ResponseWriter, httpReq *http.Request, inbound string) {
+	if len(inbound) > 0 {
+		if _, err := control.ListInbound(inbound); err != nil {
+			http.Error(writer, err.Error(), http.StatusNotFound)
+			return
+		}
+	}
+
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		http.Error(writer, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	sub := control.stream.subscribe(inbound)
+	defer control.stream.unsubscribe(sub)
+
+	header := writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	writer.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case body := <-sub.eventC:
+			if _, err := fmt.Fprintf(writer, "data: %s\n\n", body); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case <-httpReq.Context().Done():
+			return
+		}
+	}
+}
+
+// parseStreamPath returns the inbound targeted by the given stats stream path
+// and whether the path is a stats stream path: either
+// /v1/nfork/stats/stream or /v1/nfork/:inbound/stats/stream.
+func parseStreamPath(path string) (inbound string, ok bool) {
+	if !strings.HasPrefix(path, RESTPrefix+"/") {
+		return "", false
+	}
+
+	segments := strings.Split(strings.TrimPrefix(path, RESTPrefix+"/"), "/")
+
+	switch {
+	case len(segments) == 2 && segments[0] == "stats" && segments[1] == "stream":
+		return "", true
+
+	case len(segments) == 3 && segments[1] == "stats" && segments[2] == "stream":
+		return segments[0], true
+	}
+
+	return "", false
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package nfork
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsStream(t *testing.T) {
+	s0 := &TestService{T: t, Name: "s0"}
+	server0 := httptest.NewServer(s0)
+	defer server0.Close()
+
+	i0, i0URL := NewInbound("i0", "s0", map[string]string{"s0": server0.URL})
+	i1, _ := NewInbound("i1", "s0", map[string]string{"s0": server0.URL})
+
+	control := NewController([]*Inbound{i0, i1})
+	defer control.Close()
+
+	server := httptest.NewServer(control.HTTPHandler(http.NotFoundHandler()))
+	defer server.Close()
+
+	if resp, err := http.Get(server.URL + RESTPrefix + "/bob/stats/stream"); err != nil {
+		t.Fatalf("FAIL(stream): unexpected error: %s", err)
+	} else if resp.Body.Close(); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("FAIL(stream): unknown inbound returned %d", resp.StatusCode)
+	}
+
+	resp, err := http.Get(server.URL + RESTPrefix + "/i0/stats/stream")
+	if err != nil {
+		t.Fatalf("FAIL(stream): unexpected error: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("FAIL(stream): unexpected content type '%s'", contentType)
+	}
+
+	ExpectInbound(t, i0URL, "GET", "a", "r0", http.StatusOK, "s0")
+	s0.Expect("{GET /a r0}")
+
+	lines, doneC := make(chan string), make(chan int)
+	defer close(doneC)
+
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-doneC:
+				return
+			}
+		}
+		close(lines)
+	}()
+
+	timeout := time.After(5 * time.Second)
+
+	for {
+		var line string
+		select {
+		case line = <-lines:
+		case <-timeout:
+			t.Fatal("FAIL(stream): timeout waiting for a snapshot with requests")
+		}
+
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+
+		var event struct {
+			Inbound string `json:"inbound"`
+			Stats   struct {
+				Inbound struct {
+					Requests uint64 `json:"requests"`
+				} `json:"inbound"`
+			} `json:"stats"`
+		}
+
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+			t.Fatalf("FAIL(stream): unable to parse event '%s': %s", line, err)
+		}
+
+		if event.Inbound != "i0" {
+			t.Fatalf("FAIL(stream): unexpected event for inbound '%s'", event.Inbound)
+		}
+
+		if event.Stats.Inbound.Requests == 1 {
+			return
+		}
+	}
+}
+
+func TestStatsStreamClose(t *testing.T) {
+	control := &Controller{}
+	control.Close()
+
+	control = NewController(nil)
+	control.Close()
+	control.Close()
+}
@@ -0,0 +1,232 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package nfork
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultTapBuffer is the number of records that can be queued for a tap
+// before records are dropped.
+const DefaultTapBuffer = 1024
+
+// Tap selects the requests of an inbound which are streamed to a client. The
+// zero value selects all the requests.
+type Tap struct {
+
+	// Path only selects the requests whose path starts with the given prefix.
+	Path string
+
+	// Status only selects the requests where the outcome of an outbound is
+	// either the given HTTP status code (eg. 503), the given status class
+	// (eg. 5xx), ErrorClass or TimeoutClass. If Outbound is set, only the
+	// outcome of that outbound is considered.
+	Status string
+
+	// Outbound only reports the outcome of the given outbound.
+	Outbound string
+
+	// Sample is the probability that a matching request is selected. Values
+	// outside of ]0, 1[ select all the matching requests.
+	Sample float64
+
+	recordC chan []byte
+}
+
+// ParseTap returns the tap described by the query parameters path, status,
+// outbound and sample of the given request.
+func ParseTap(httpReq *http.Request) (*Tap, error) {
+	query := httpReq.URL.Query()
+
+	tap := &Tap{
+		Path:     query.Get("path"),
+		Status:   query.Get("status"),
+		Outbound: query.Get("outbound"),
+	}
+
+	if sample := query.Get("sample"); len(sample) > 0 {
+		var err error
+		if tap.Sample, err = strconv.ParseFloat(sample, 64); err != nil {
+			return nil, fmt.Errorf("invalid sample '%s': %s", sample, err)
+		}
+	}
+
+	return tap, nil
+}
+
+// match returns the record to send for the given access record or nil if the
+// tap doesn't select the request.
+func (tap *Tap) match(record *AccessRecord) *AccessRecord {
+	if !strings.HasPrefix(record.Path, tap.Path) {
+		return nil
+	}
+
+	if len(tap.Outbound) > 0 {
+		event, ok := record.Outbounds[tap.Outbound]
+		if !ok || !tap.matchStatus(event) {
+			return nil
+		}
+
+		filtered := *record
+		filtered.Outbounds = map[string]Event{tap.Outbound: event}
+		record = &filtered
+
+	} else if len(tap.Status) > 0 {
+		matched := false
+		for _, event := range record.Outbounds {
+			if matched = tap.matchStatus(event); matched {
+				break
+			}
+		}
+		if !matched {
+			return nil
+		}
+	}
+
+	if tap.Sample > 0 && tap.Sample < 1 && rand.Float64() >= tap.Sample {
+		return nil
+	}
+
+	return record
+}
+
+func (tap *Tap) matchStatus(event Event) bool {
+	return len(tap.Status) == 0 || tap.Status == event.Outcome() || tap.Status == event.Class()
+}
+
+// tapHub dispatches the access records of an inbound to its taps. It's shared
+// between an inbound and its copies.
+type tapHub struct {
+	active int32
+
+	mutex sync.Mutex
+	taps  map[*Tap]struct{}
+}
+
+// isActive returns true if the hub has at least one tap. It's used to avoid
+// building access records when nobody is listening.
+func (hub *tapHub) isActive() bool {
+	return atomic.LoadInt32(&hub.active) > 0
+}
+
+func (hub *tapHub) add(tap *Tap) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	if hub.taps == nil {
+		hub.taps = make(map[*Tap]struct{})
+	}
+
+	tap.recordC = make(chan []byte, DefaultTapBuffer)
+	hub.taps[tap] = struct{}{}
+	atomic.AddInt32(&hub.active, 1)
+}
+
+func (hub *tapHub) remove(tap *Tap) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	if _, ok := hub.taps[tap]; ok {
+		delete(hub.taps, tap)
+		atomic.AddInt32(&hub.active, -1)
+		close(tap.recordC)
+	}
+}
+
+// close removes all the taps which ends their streams.
+func (hub *tapHub) close() {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	for tap := range hub.taps {
+		delete(hub.taps, tap)
+		atomic.AddInt32(&hub.active, -1)
+		close(tap.recordC)
+	}
+}
+
+func (hub *tapHub) publish(record *AccessRecord) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	for tap := range hub.taps {
+		if matched := tap.match(record); matched != nil {
+			select {
+			case tap.recordC <- formatAccessJSON(matched):
+			default:
+			}
+		}
+	}
+}
+
+// ServeTap streams the requests of the given inbound selected by the tap
+// described in the query parameters as JSON lines until the client disconnects
+// or the inbound is removed. See ParseTap for the query parameters and
+// AccessLogJSON for the format of each line.
+func (control *Controller) ServeTap(writer http.ResponseWriter, httpReq *http.Request, inbound string) {
+	tap, err := ParseTap(httpReq)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	control.mutex.Lock()
+	server, ok := control.inbounds[inbound]
+	control.mutex.Unlock()
+
+	if !ok {
+		http.Error(writer, fmt.Sprintf("unknown inbound '%s'", inbound), http.StatusNotFound)
+		return
+	}
+
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		http.Error(writer, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	hub := server.getInbound().taps
+	hub.add(tap)
+	defer hub.remove(tap)
+
+	writer.Header().Set("Content-Type", "application/x-ndjson")
+	writer.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case line, ok := <-tap.recordC:
+			if !ok {
+				return
+			}
+			if _, err := writer.Write(line); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case <-httpReq.Context().Done():
+			return
+		}
+	}
+}
+
+// parseTapPath returns the inbound targeted by the given tap path and whether
+// the path is a tap path: /v1/nfork/:inbound/tap.
+func parseTapPath(path string) (inbound string, ok bool) {
+	if !strings.HasPrefix(path, RESTPrefix+"/") {
+		return "", false
+	}
+
+	segments := strings.Split(strings.TrimPrefix(path, RESTPrefix+"/"), "/")
+	if len(segments) == 2 && len(segments[0]) > 0 && segments[1] == "tap" {
+		return segments[0], true
+	}
+
+	return "", false
+}
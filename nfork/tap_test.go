@@ -0,0 +1,160 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package nfork
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTapMatch(t *testing.T) {
+	record := &AccessRecord{
+		Path:   "/search?q=a",
+		Active: "s0",
+		Outbounds: map[string]Event{
+			"s0": {Response: 200},
+			"s1": {Response: 503},
+			"s2": {Timeout: true},
+		},
+	}
+
+	for _, test := range []struct {
+		tap *Tap
+		exp []string
+	}{
+		{&Tap{}, []string{"s0", "s1", "s2"}},
+		{&Tap{Path: "/search"}, []string{"s0", "s1", "s2"}},
+		{&Tap{Path: "/users"}, nil},
+		{&Tap{Status: "5xx"}, []string{"s0", "s1", "s2"}},
+		{&Tap{Status: "404"}, nil},
+		{&Tap{Outbound: "s1"}, []string{"s1"}},
+		{&Tap{Outbound: "s1", Status: "503"}, []string{"s1"}},
+		{&Tap{Outbound: "s0", Status: "503"}, nil},
+		{&Tap{Outbound: "s2", Status: TimeoutClass}, []string{"s2"}},
+		{&Tap{Outbound: "s3"}, nil},
+	} {
+		matched := test.tap.match(record)
+		if matched == nil {
+			if test.exp != nil {
+				t.Errorf("FAIL(%+v): expected a match", test.tap)
+			}
+			continue
+		}
+
+		if test.exp == nil {
+			t.Errorf("FAIL(%+v): unexpected match", test.tap)
+			continue
+		}
+
+		if len(matched.Outbounds) != len(test.exp) {
+			t.Errorf("FAIL(%+v): unexpected outbounds -> %v", test.tap, matched.Outbounds)
+		}
+		for _, outbound := range test.exp {
+			if _, ok := matched.Outbounds[outbound]; !ok {
+				t.Errorf("FAIL(%+v): missing outbound %s -> %v", test.tap, outbound, matched.Outbounds)
+			}
+		}
+	}
+
+	if len(record.Outbounds) != 3 {
+		t.Errorf("FAIL: original record was modified -> %v", record.Outbounds)
+	}
+}
+
+func TestControllerTap(t *testing.T) {
+	s0 := &TestService{T: t, Name: "s0"}
+	server0 := httptest.NewServer(s0)
+	defer server0.Close()
+
+	s1 := &TestService{T: t, Name: "s1", Code: http.StatusCreated}
+	server1 := httptest.NewServer(s1)
+	defer server1.Close()
+
+	i0, i0URL := NewInbound("i0", "s0", map[string]string{"s0": server0.URL, "s1": server1.URL})
+
+	control := NewController([]*Inbound{i0})
+	defer control.Close()
+
+	server := httptest.NewServer(control.HTTPHandler(http.NotFoundHandler()))
+	defer server.Close()
+
+	OpenTap := func(query string) chan string {
+		resp, err := http.Get(server.URL + RESTPrefix + "/i0/tap?" + query)
+		if err != nil {
+			t.Fatalf("FAIL(tap): unexpected error -> %s", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("FAIL(tap): unexpected status -> %d", resp.StatusCode)
+		}
+
+		lines := make(chan string, 10)
+		go func() {
+			defer resp.Body.Close()
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				lines <- scanner.Text()
+			}
+			close(lines)
+		}()
+		return lines
+	}
+
+	ExpectLine := func(title string, lines chan string, expPath string, expOutbounds ...string) {
+		var line string
+		select {
+		case line = <-lines:
+		case <-time.After(time.Second):
+			t.Fatalf("FAIL(%s): timeout waiting for a record", title)
+		}
+
+		var record struct {
+			Path      string                     `json:"path"`
+			Outbounds map[string]json.RawMessage `json:"outbounds"`
+		}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("FAIL(%s): unable to parse record '%s': %s", title, line, err)
+		}
+
+		if record.Path != expPath || len(record.Outbounds) != len(expOutbounds) {
+			t.Errorf("FAIL(%s): unexpected record -> %s", title, line)
+		}
+		for _, outbound := range expOutbounds {
+			if _, ok := record.Outbounds[outbound]; !ok {
+				t.Errorf("FAIL(%s): missing outbound %s -> %s", title, outbound, line)
+			}
+		}
+	}
+
+	if resp, err := http.Get(server.URL + RESTPrefix + "/bob/tap"); err != nil {
+		t.Fatalf("FAIL(tap): unexpected error -> %s", err)
+	} else if resp.Body.Close(); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("FAIL(tap): unknown inbound returned %d", resp.StatusCode)
+	}
+
+	shadow := OpenTap("outbound=s1&status=2xx")
+	search := OpenTap("path=/b")
+
+	ExpectInbound(t, i0URL, "GET", "a", "r0", http.StatusOK, "s0")
+	ExpectInbound(t, i0URL, "GET", "b", "r1", http.StatusOK, "s0")
+	s0.Expect("{GET /a r0}", "{GET /b r1}")
+	s1.Expect("{GET /a r0}", "{GET /b r1}")
+
+	ExpectLine("shadow", shadow, "/a", "s1")
+	ExpectLine("shadow", shadow, "/b", "s1")
+	ExpectLine("search", search, "/b", "s0", "s1")
+
+	ExpectRemoveIn(t, control, "i0")
+
+	select {
+	case line, ok := <-search:
+		if ok {
+			t.Errorf("FAIL(remove): unexpected record -> %s", line)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("FAIL(remove): tap still open after the inbound was removed")
+	}
+}
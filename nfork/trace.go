@@ -0,0 +1,237 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package nfork
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TraceParentHeader is the header defined by the W3C Trace Context
+// specification to propagate the trace context.
+const TraceParentHeader = "Traceparent"
+
+// TraceStateHeader is the header defined by the W3C Trace Context
+// specification to carry vendor specific trace data. It's forwarded as is
+// unless the traceparent header is invalid in which case it's dropped.
+const TraceStateHeader = "Tracestate"
+
+// TraceContext is the trace context carried by the traceparent header.
+type TraceContext struct {
+
+	// TraceID is the hex encoded 16 bytes ID of the trace.
+	TraceID string
+
+	// SpanID is the hex encoded 8 bytes ID of the span.
+	SpanID string
+
+	// Sampled indicates whether the caller may have recorded the trace.
+	Sampled bool
+}
+
+// ParseTraceParent parses the value of a traceparent header. An error is
+// returned if the value is malformed or if any of the IDs are invalid.
+func ParseTraceParent(value string) (ctx TraceContext, err error) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return ctx, fmt.Errorf("malformed traceparent '%s'", value)
+	}
+
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+
+	if len(version) != 2 || !isHex(version) || version == "ff" {
+		return ctx, fmt.Errorf("invalid traceparent version in '%s'", value)
+	}
+
+	if version == "00" && len(parts) != 4 {
+		return ctx, fmt.Errorf("malformed traceparent '%s'", value)
+	}
+
+	if len(traceID) != 32 || !isHex(traceID) || isZero(traceID) {
+		return ctx, fmt.Errorf("invalid trace ID in '%s'", value)
+	}
+
+	if len(spanID) != 16 || !isHex(spanID) || isZero(spanID) {
+		return ctx, fmt.Errorf("invalid span ID in '%s'", value)
+	}
+
+	if len(flags) != 2 || !isHex(flags) {
+		return ctx, fmt.Errorf("invalid trace flags in '%s'", value)
+	}
+
+	bits, _ := strconv.ParseUint(flags, 16, 8)
+
+	ctx.TraceID = traceID
+	ctx.SpanID = spanID
+	ctx.Sampled = bits&1 == 1
+	return
+}
+
+// String returns the value of the traceparent header for the trace context.
+func (ctx TraceContext) String() string {
+	flags := "00"
+	if ctx.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", ctx.TraceID, ctx.SpanID, flags)
+}
+
+func isHex(value string) bool {
+	for _, c := range value {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func isZero(value string) bool {
+	return strings.Trim(value, "0") == ""
+}
+
+func randomID(n int) string {
+	id := make([]byte, n)
+	if _, err := rand.Read(id); err != nil {
+		log.Panicf("unable to generate ID: %s", err)
+	}
+	return hex.EncodeToString(id)
+}
+
+// Kinds of spans created by an inbound.
+const (
+	SpanServer = "server"
+	SpanClient = "client"
+)
+
+// Span is a single operation of a trace: either the processing of a request by
+// an inbound (SpanServer) or the forwarding of a request to one of its
+// outbounds (SpanClient).
+type Span struct {
+	TraceID  string `json:"traceId"`
+	SpanID   string `json:"spanId"`
+	ParentID string `json:"parentId,omitempty"`
+
+	Name  string    `json:"name"`
+	Kind  string    `json:"kind"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	// Error is set if the operation failed.
+	Error bool `json:"error,omitempty"`
+
+	Attributes map[string]string `json:"attributes,omitempty"`
+
+	sampled   bool
+	requestID string
+}
+
+// SpanExporter is notified of each span once it's completed.
+type SpanExporter interface {
+	ExportSpan(span *Span)
+}
+
+// context returns the trace context used to propagate the span.
+func (span *Span) context() TraceContext {
+	return TraceContext{TraceID: span.TraceID, SpanID: span.SpanID, Sampled: span.sampled}
+}
+
+// startSpan starts the server span of the given request. The span is a child
+// of the trace context carried by the request or the root of a new trace.
+func (inbound *Inbound) startSpan(httpReq *http.Request, requestID string, t0 time.Time) *Span {
+	span := &Span{
+		SpanID: randomID(8),
+		Name:   inbound.Name,
+		Kind:   SpanServer,
+		Start:  t0,
+		Attributes: map[string]string{
+			"nfork.inbound": inbound.Name,
+			"http.method":   httpReq.Method,
+			"http.target":   httpReq.URL.RequestURI(),
+		},
+		requestID: requestID,
+	}
+
+	if ctx, err := ParseTraceParent(httpReq.Header.Get(TraceParentHeader)); err == nil {
+		span.TraceID = ctx.TraceID
+		span.ParentID = ctx.SpanID
+		span.sampled = ctx.Sampled
+	} else {
+		span.TraceID = randomID(16)
+		span.sampled = true
+
+		// The tracestate can't be used without a valid traceparent so it
+		// must not be propagated with the new trace.
+		httpReq.Header.Del(TraceStateHeader)
+	}
+
+	return span
+}
+
+// startOutboundSpan starts a child span of the given server span for the
+// request forwarded to the given outbound and propagates it in the headers of
+// the request.
+func (inbound *Inbound) startOutboundSpan(
+	parent *Span, outbound string, newReq *http.Request, t0 time.Time) *Span {
+
+	role := "shadow"
+	if outbound == inbound.Active {
+		role = "active"
+	}
+
+	span := &Span{
+		TraceID:  parent.TraceID,
+		SpanID:   randomID(8),
+		ParentID: parent.SpanID,
+		Name:     outbound,
+		Kind:     SpanClient,
+		Start:    t0,
+		Attributes: map[string]string{
+			"nfork.inbound":  inbound.Name,
+			"nfork.outbound": outbound,
+			"nfork.role":     role,
+			"http.method":    newReq.Method,
+			"http.target":    newReq.URL.RequestURI(),
+		},
+		sampled:   parent.sampled,
+		requestID: parent.requestID,
+	}
+
+	// The header is shared between the requests sent to all the outbounds so
+	// each of them needs its own copy.
+	header := make(http.Header, len(newReq.Header)+1)
+	for key, values := range newReq.Header {
+		header[key] = values
+	}
+	header.Set(TraceParentHeader, span.context().String())
+	newReq.Header = header
+
+	return span
+}
+
+// finishSpan completes the span with the outcome of the given event and
+// exports it if the trace is sampled.
+func (inbound *Inbound) finishSpan(span *Span, event Event) {
+	span.End = span.Start.Add(event.Latency)
+	span.Attributes["nfork.outcome"] = event.Outcome()
+
+	if len(span.requestID) > 0 {
+		span.Attributes["nfork.request_id"] = span.requestID
+	}
+
+	if event.Error || event.Timeout {
+		span.Error = true
+	} else {
+		span.Attributes["http.status_code"] = strconv.Itoa(event.Response)
+		span.Error = event.BodyError || event.Failed
+	}
+
+	if span.sampled {
+		inbound.Tracer.ExportSpan(span)
+	}
+}
@@ -0,0 +1,353 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package nfork
+
+import (
+	"github.com/datacratic/goklog/klog"
+
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SpanFile is a SpanExporter which appends each span to a file as a JSON line.
+type SpanFile struct {
+
+	// Path is the file where the spans are appended or AccessLogStdout.
+	Path string
+
+	initialize sync.Once
+
+	mutex  sync.Mutex
+	writer io.Writer
+	file   *os.File
+}
+
+// Init initializes the object.
+func (spanFile *SpanFile) Init() {
+	spanFile.initialize.Do(spanFile.init)
+}
+
+func (spanFile *SpanFile) init() {
+	if spanFile.Path == AccessLogStdout {
+		spanFile.writer = os.Stdout
+		return
+	}
+
+	file, err := os.OpenFile(spanFile.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		klog.KPrintf("trace.error", "unable to open '%s': %s", spanFile.Path, err)
+		return
+	}
+
+	spanFile.file = file
+	spanFile.writer = file
+}
+
+// Close closes the underlying file. Spans exported after the file is closed
+// are dropped.
+func (spanFile *SpanFile) Close() {
+	spanFile.Init()
+	spanFile.mutex.Lock()
+	defer spanFile.mutex.Unlock()
+
+	if spanFile.file != nil {
+		spanFile.file.Close()
+		spanFile.file = nil
+	}
+	spanFile.writer = nil
+}
+
+// ExportSpan appends the given span to the file.
+func (spanFile *SpanFile) ExportSpan(span *Span) {
+	spanFile.Init()
+
+	line, err := json.Marshal(span)
+	if err != nil {
+		klog.KPrintf("trace.error", "unable to marshal span: %s", err)
+		return
+	}
+
+	spanFile.mutex.Lock()
+	defer spanFile.mutex.Unlock()
+
+	if spanFile.writer == nil {
+		return
+	}
+
+	if _, err := spanFile.writer.Write(append(line, '\n')); err != nil {
+		klog.KPrintf("trace.error", "unable to write to '%s': %s", spanFile.Path, err)
+	}
+}
+
+// DefaultSpanQueueSize is used if QueueSize is not set in SpanCollector.
+const DefaultSpanQueueSize = 4096
+
+// DefaultSpanBatchSize is used if BatchSize is not set in SpanCollector.
+const DefaultSpanBatchSize = 512
+
+// DefaultSpanFlushRate is used if FlushRate is not set in SpanCollector.
+const DefaultSpanFlushRate = 1 * time.Second
+
+// DefaultServiceName is used if ServiceName is not set in SpanCollector.
+const DefaultServiceName = "nfork"
+
+// SpanCollector is a SpanExporter which sends spans in batches to a collector
+// using the JSON encoding of the OTLP/HTTP protocol. Spans are queued and sent
+// asynchronously and are dropped if the queue is full so that a slow collector
+// never holds up the requests.
+type SpanCollector struct {
+
+	// URL is the endpoint of the collector where spans are posted (eg.
+	// http://localhost:4318/v1/traces).
+	URL string
+
+	// ServiceName is the name of the service reported to the collector.
+	ServiceName string
+
+	// QueueSize is the maximum number of spans waiting to be sent.
+	QueueSize int
+
+	// BatchSize is the maximum number of spans sent in a single request.
+	BatchSize int
+
+	// FlushRate is the maximum amount of time a span waits before being sent.
+	FlushRate time.Duration
+
+	// Client is the http.Client used to post the spans.
+	Client *http.Client
+
+	initialize sync.Once
+
+	spanC     chan *Span
+	shutdown  sync.Once
+	shutdownC chan chan int
+}
+
+// Init initializes the object.
+func (collector *SpanCollector) Init() {
+	collector.initialize.Do(collector.init)
+}
+
+func (collector *SpanCollector) init() {
+	if len(collector.ServiceName) == 0 {
+		collector.ServiceName = DefaultServiceName
+	}
+
+	if collector.QueueSize == 0 {
+		collector.QueueSize = DefaultSpanQueueSize
+	}
+
+	if collector.BatchSize == 0 {
+		collector.BatchSize = DefaultSpanBatchSize
+	}
+
+	if collector.FlushRate == 0 {
+		collector.FlushRate = DefaultSpanFlushRate
+	}
+
+	if collector.Client == nil {
+		collector.Client = &http.Client{Timeout: 5 * time.Second}
+	}
+
+	collector.spanC = make(chan *Span, collector.QueueSize)
+	collector.shutdownC = make(chan chan int)
+	go collector.run()
+}
+
+// Validate returns an error if one of the SpanCollector invariants are not
+// satisfied.
+func (collector *SpanCollector) Validate() error {
+	if len(collector.URL) == 0 {
+		return fmt.Errorf("missing collector URL")
+	}
+
+	URL, err := url.Parse(collector.URL)
+	if err != nil {
+		return fmt.Errorf("invalid collector URL '%s': %s", collector.URL, err)
+	}
+
+	if URL.Scheme != "http" && URL.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme in collector URL '%s'", collector.URL)
+	}
+
+	return nil
+}
+
+// Close sends the queued spans and terminates the collector. Calling Close
+// more than once has no effects.
+func (collector *SpanCollector) Close() {
+	collector.Init()
+
+	collector.shutdown.Do(func() {
+		doneC := make(chan int)
+		collector.shutdownC <- doneC
+		<-doneC
+	})
+}
+
+// ExportSpan queues the given span to be sent.
+func (collector *SpanCollector) ExportSpan(span *Span) {
+	collector.Init()
+
+	select {
+	case collector.spanC <- span:
+	default:
+		klog.KPrintf("trace.dropped", "queue full, dropping span '%s'", span.SpanID)
+	}
+}
+
+func (collector *SpanCollector) run() {
+	tick := time.NewTicker(collector.FlushRate)
+	defer tick.Stop()
+
+	var batch []*Span
+
+	for {
+		select {
+		case span := <-collector.spanC:
+			if batch = append(batch, span); len(batch) >= collector.BatchSize {
+				collector.send(batch)
+				batch = nil
+			}
+
+		case <-tick.C:
+			if len(batch) > 0 {
+				collector.send(batch)
+				batch = nil
+			}
+
+		case doneC := <-collector.shutdownC:
+			for len(collector.spanC) > 0 {
+				batch = append(batch, <-collector.spanC)
+			}
+			if len(batch) > 0 {
+				collector.send(batch)
+			}
+			close(doneC)
+			return
+		}
+	}
+}
+
+func (collector *SpanCollector) send(batch []*Span) {
+	body, err := json.Marshal(collector.format(batch))
+	if err != nil {
+		klog.KPrintf("trace.error", "unable to marshal spans: %s", err)
+		return
+	}
+
+	resp, err := collector.Client.Post(collector.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		klog.KPrintf("trace.error", "unable to post spans to '%s': %s", collector.URL, err)
+		return
+	}
+
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		klog.KPrintf("trace.error", "unable to post spans to '%s': %s", collector.URL, resp.Status)
+	}
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code int `json:"code"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+// OTLP span kinds and status codes.
+const (
+	otlpKindServer  = 2
+	otlpKindClient  = 3
+	otlpStatusError = 2
+)
+
+func (collector *SpanCollector) format(batch []*Span) *otlpRequest {
+	scope := otlpScopeSpans{}
+	scope.Scope.Name = "nfork"
+
+	for _, span := range batch {
+		spanJSON := otlpSpan{
+			TraceID:           span.TraceID,
+			SpanID:            span.SpanID,
+			ParentSpanID:      span.ParentID,
+			Name:              span.Name,
+			Kind:              otlpKindServer,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+		}
+
+		if span.Kind == SpanClient {
+			spanJSON.Kind = otlpKindClient
+		}
+
+		if span.Error {
+			spanJSON.Status.Code = otlpStatusError
+		}
+
+		var keys []string
+		for key := range span.Attributes {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			spanJSON.Attributes = append(spanJSON.Attributes, otlpKeyValue{key, otlpValue{span.Attributes[key]}})
+		}
+
+		scope.Spans = append(scope.Spans, spanJSON)
+	}
+
+	resource := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scope}}
+	resource.Resource.Attributes = []otlpKeyValue{{"service.name", otlpValue{collector.ServiceName}}}
+
+	return &otlpRequest{ResourceSpans: []otlpResourceSpans{resource}}
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package nfork
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	valid := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	ctx, err := ParseTraceParent(valid)
+	if err != nil {
+		t.Fatalf("FAIL(valid): unexpected error -> %s", err)
+	}
+
+	if ctx.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || ctx.SpanID != "00f067aa0ba902b7" || !ctx.Sampled {
+		t.Errorf("FAIL(valid): unexpected context -> %+v", ctx)
+	}
+
+	if ctx.String() != valid {
+		t.Errorf("FAIL(valid): unexpected string -> %s != %s", ctx.String(), valid)
+	}
+
+	for _, value := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		if _, err := ParseTraceParent(value); err == nil {
+			t.Errorf("FAIL(%s): expected error", value)
+		}
+	}
+}
+
+func TestInboundTrace(t *testing.T) {
+	parentC := make(chan string, 10)
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		parentC <- httpReq.Header.Get(TraceParentHeader)
+	})
+
+	server0 := httptest.NewServer(handler)
+	defer server0.Close()
+
+	server1 := httptest.NewServer(handler)
+	defer server1.Close()
+
+	requestC := make(chan *otlpRequest, 10)
+	stub := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		request := new(otlpRequest)
+		if err := json.NewDecoder(httpReq.Body).Decode(request); err != nil {
+			t.Errorf("FAIL(collector): unable to decode spans -> %s", err)
+		}
+		requestC <- request
+	}))
+	defer stub.Close()
+
+	collector := &SpanCollector{URL: stub.URL, FlushRate: time.Hour}
+	exporter := &TestExporter{Exporter: collector, SpanC: make(chan *Span, 10)}
+
+	inbound := &Inbound{
+		Name:     "bob",
+		Outbound: map[string]string{"s0": server0.URL, "s1": server1.URL},
+		Active:   "s0",
+		Tracer:   exporter,
+	}
+	server := httptest.NewServer(inbound)
+	defer server.Close()
+
+	traceID, spanID := "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+
+	req, _ := http.NewRequest("GET", server.URL+"/a", nil)
+	req.Header.Set(TraceParentHeader, "00-"+traceID+"-"+spanID+"-01")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("FAIL(send): unexpected error -> %s", err)
+	}
+	resp.Body.Close()
+
+	parents := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		ctx, err := ParseTraceParent(<-parentC)
+		if err != nil {
+			t.Fatalf("FAIL(outbound): invalid traceparent -> %s", err)
+		}
+		if ctx.TraceID != traceID || ctx.SpanID == spanID || !ctx.Sampled {
+			t.Errorf("FAIL(outbound): unexpected context -> %+v", ctx)
+		}
+		parents[ctx.SpanID] = true
+	}
+
+	if len(parents) != 2 {
+		t.Errorf("FAIL(outbound): outbounds share a span -> %v", parents)
+	}
+
+	// Wait for the shadow to complete before flushing the spans.
+	for i := 0; i < 3; i++ {
+		select {
+		case <-exporter.SpanC:
+		case <-time.After(time.Second):
+			t.Fatalf("FAIL(collector): only %d spans exported", i)
+		}
+	}
+	collector.Close()
+	collector.Close()
+
+	request := <-requestC
+	spans := request.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 3 {
+		t.Fatalf("FAIL(collector): unexpected spans -> %+v", spans)
+	}
+
+	var serverSpan string
+	for _, span := range spans {
+		if span.Kind == otlpKindServer {
+			serverSpan = span.SpanID
+			if span.ParentSpanID != spanID {
+				t.Errorf("FAIL(collector): unexpected server parent -> %s", span.ParentSpanID)
+			}
+		}
+	}
+
+	for _, span := range spans {
+		if span.TraceID != traceID {
+			t.Errorf("FAIL(collector): unexpected trace ID -> %s", span.TraceID)
+		}
+		if span.Kind == otlpKindClient && (span.ParentSpanID != serverSpan || !parents[span.SpanID]) {
+			t.Errorf("FAIL(collector): unexpected client span -> %+v", span)
+		}
+	}
+}
+
+// TestExporter forwards the spans to Exporter if set and notifies SpanC of
+// each span.
+type TestExporter struct {
+	Exporter SpanExporter
+	SpanC    chan *Span
+}
+
+func (exporter *TestExporter) ExportSpan(span *Span) {
+	if exporter.Exporter != nil {
+		exporter.Exporter.ExportSpan(span)
+	}
+	exporter.SpanC <- span
+}
+
+func TestInboundTraceInvalid(t *testing.T) {
+	headerC := make(chan http.Header, 10)
+	server0 := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpReq *http.Request) {
+		headerC <- httpReq.Header
+	}))
+	defer server0.Close()
+
+	inbound := &Inbound{
+		Name:     "bob",
+		Outbound: map[string]string{"s0": server0.URL},
+		Active:   "s0",
+		Tracer:   &TestExporter{SpanC: make(chan *Span, 10)},
+	}
+	server := httptest.NewServer(inbound)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/a", nil)
+	req.Header.Set(TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7")
+	req.Header.Set(TraceStateHeader, "vendor=value")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("FAIL(send): unexpected error -> %s", err)
+	}
+	resp.Body.Close()
+
+	header := <-headerC
+	if _, err := ParseTraceParent(header.Get(TraceParentHeader)); err != nil {
+		t.Errorf("FAIL(outbound): invalid traceparent -> %s", err)
+	}
+	if state := header.Get(TraceStateHeader); state != "" {
+		t.Errorf("FAIL(outbound): unexpected tracestate -> %s", state)
+	}
+}
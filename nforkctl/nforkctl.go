@@ -0,0 +1,567 @@
+// Copyright (c) 2014 Datacratic. All rights reserved.
+
+package main
+
+import (
+	"github.com/datacratic/gonfork/nfork"
+	"github.com/datacratic/gonfork/nfork/client"
+
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	addr = flag.String(
+		"addr", "localhost:9090",
+		"host:port or URL of the nfork controller interface")
+
+	jsonOutput = flag.Bool(
+		"json", false,
+		"print the responses as JSON instead of tables")
+
+	window = flag.String(
+		"window", "",
+		"window of the stats: 1s, one of the configured windows or total")
+
+	token = flag.String(
+		"token", "",
+		"bearer token sent to the controller; defaults to $NFORK_TOKEN")
+
+	user = flag.String(
+		"user", "",
+		"user:password sent to the controller using basic authentication; defaults to $NFORK_USER")
+
+	interval = flag.Duration(
+		"interval", 1*time.Second,
+		"refresh interval of the watch command")
+)
+
+type command struct {
+	Args    string
+	Help    string
+	MinArgs int
+	MaxArgs int
+	Run     func(args []string) error
+}
+
+var commands map[string]*command
+
+func init() {
+	commands = map[string]*command{
+		"list":           {"", "list the inbounds and their outbounds", 0, 0, list},
+		"show":           {"<inbound>", "show the configuration of an inbound", 1, 1, show},
+		"add-inbound":    {"<file>", "add the inbound described in a JSON file or - for stdin", 1, 1, addInbound},
+		"remove-inbound": {"<inbound>", "remove an inbound", 1, 1, removeInbound},
+		"add":            {"<inbound> <outbound> <addr>", "add or replace an outbound", 3, 3, addOutbound},
+		"remove":         {"<inbound> <outbound>", "remove an outbound", 2, 2, removeOutbound},
+		"activate":       {"<inbound> <outbound>", "make an outbound the active one", 2, 2, activate},
+		"stats":          {"[<inbound> [<outbound>]]", "show the stats (see --window)", 0, 2, stats},
+		"reset":          {"<inbound> [<outbound>]", "reset the stats of an inbound or outbound", 1, 2, reset},
+		"codes":          {"<inbound> [<outbound>]", "show the status code confusion matrices", 1, 2, codes},
+		"history":        {"<inbound> [<outbound>]", "show the stats history", 1, 2, history},
+		"errors":         {"<inbound> <outbound>", "show the last failed or slow requests", 2, 2, errorSamples},
+		"watch":          {"<command> [<args>]", "repeat a command every --interval", 1, -1, watch},
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: nforkctl [<flags>] <command> [<args>]\n\ncommands:\n")
+
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	writer := tabwriter.NewWriter(os.Stderr, 0, 8, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(writer, "  %s %s\t%s\n", name, commands[name].Args, commands[name].Help)
+	}
+	writer.Flush()
+
+	fmt.Fprintf(os.Stderr, "\nflags:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "nforkctl: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command '%s'", args[0])
+	}
+
+	if n := len(args) - 1; n < cmd.MinArgs || (cmd.MaxArgs >= 0 && n > cmd.MaxArgs) {
+		return fmt.Errorf("usage: nforkctl %s %s", args[0], cmd.Args)
+	}
+
+	return cmd.Run(args[1:])
+}
+
+func newClient() *client.Client {
+	URL := *addr
+	if !strings.HasPrefix(URL, "http://") && !strings.HasPrefix(URL, "https://") {
+		URL = "http://" + URL
+	}
+
+	// The credentials are read from the environment by default so that they
+	// don't show up in the list of processes.
+	control := &client.Client{URL: URL, Token: *token}
+	if len(control.Token) == 0 {
+		control.Token = os.Getenv("NFORK_TOKEN")
+	}
+
+	credentials := *user
+	if len(credentials) == 0 {
+		credentials = os.Getenv("NFORK_USER")
+	}
+	if i := strings.Index(credentials, ":"); i >= 0 {
+		control.User, control.Password = credentials[:i], credentials[i+1:]
+	} else {
+		control.User = credentials
+	}
+
+	return control
+}
+
+func printJSON(value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Printf("%s\n", data)
+	return err
+}
+
+func newTable(columns ...string) *tabwriter.Writer {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(writer, strings.Join(columns, "\t"))
+	return writer
+}
+
+func row(writer io.Writer, values ...interface{}) {
+	cells := make([]string, len(values))
+	for i, value := range values {
+		cells[i] = fmt.Sprint(value)
+	}
+	fmt.Fprintln(writer, strings.Join(cells, "\t"))
+}
+
+func list(args []string) error {
+	inbounds, err := newClient().List()
+	if err != nil {
+		return err
+	}
+
+	if *jsonOutput {
+		return printJSON(inbounds)
+	}
+
+	sort.Sort(inboundArray(inbounds))
+
+	table := newTable("INBOUND", "LISTEN", "OUTBOUND", "ADDRESS", "ROLE")
+	for _, inbound := range inbounds {
+		printOutbounds(table, inbound)
+	}
+	return table.Flush()
+}
+
+func show(args []string) error {
+	inbound, err := newClient().ListInbound(args[0])
+	if err != nil {
+		return err
+	}
+
+	if *jsonOutput {
+		return printJSON(inbound)
+	}
+
+	table := newTable("INBOUND", "LISTEN", "OUTBOUND", "ADDRESS", "ROLE")
+	printOutbounds(table, inbound)
+	return table.Flush()
+}
+
+func printOutbounds(table io.Writer, inbound *nfork.Inbound) {
+	var outbounds []string
+	for outbound := range inbound.Outbound {
+		outbounds = append(outbounds, outbound)
+	}
+	sort.Strings(outbounds)
+
+	for _, outbound := range outbounds {
+		role := "shadow"
+		if outbound == inbound.Active {
+			role = "active"
+		}
+		row(table, inbound.Name, inbound.Listen, outbound, inbound.Outbound[outbound], role)
+	}
+}
+
+func addInbound(args []string) error {
+	var body []byte
+	var err error
+
+	if args[0] == "-" {
+		body, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		body, err = ioutil.ReadFile(args[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	inbound := new(nfork.Inbound)
+	if err := json.Unmarshal(body, inbound); err != nil {
+		return fmt.Errorf("unable to parse inbound '%s': %s", args[0], err)
+	}
+
+	return newClient().AddInbound(inbound)
+}
+
+func removeInbound(args []string) error {
+	return newClient().RemoveInbound(args[0])
+}
+
+func addOutbound(args []string) error {
+	return newClient().AddOutbound(args[0], args[1], args[2])
+}
+
+func removeOutbound(args []string) error {
+	return newClient().RemoveOutbound(args[0], args[1])
+}
+
+func activate(args []string) error {
+	return newClient().ActivateOutbound(args[0], args[1])
+}
+
+func stats(args []string) error {
+	control := newClient()
+
+	switch len(args) {
+	case 0:
+		var result map[string]*nfork.InboundStats
+		var err error
+
+		if len(*window) > 0 {
+			result, err = control.ReadStatsWindow(*window)
+		} else {
+			result, err = control.ReadStats()
+		}
+		if err != nil {
+			return err
+		}
+		if *jsonOutput {
+			return printJSON(result)
+		}
+
+		var inbounds []string
+		for inbound := range result {
+			inbounds = append(inbounds, inbound)
+		}
+		sort.Strings(inbounds)
+
+		table := newStatsTable("INBOUND", "OUTBOUND")
+		for _, inbound := range inbounds {
+			printInboundStats(table, inbound, result[inbound])
+		}
+		return table.Flush()
+
+	case 1:
+		var result *nfork.InboundStats
+		var err error
+
+		if len(*window) > 0 {
+			result, err = control.ReadInboundStatsWindow(args[0], *window)
+		} else {
+			result, err = control.ReadInboundStats(args[0])
+		}
+		if err != nil {
+			return err
+		}
+		if *jsonOutput {
+			return printJSON(result)
+		}
+
+		table := newStatsTable("INBOUND", "OUTBOUND")
+		printInboundStats(table, args[0], result)
+		return table.Flush()
+
+	default:
+		var result *nfork.Stats
+		var err error
+
+		if len(*window) > 0 {
+			result, err = control.ReadOutboundStatsWindow(args[0], args[1], *window)
+		} else {
+			result, err = control.ReadOutboundStats(args[0], args[1])
+		}
+		if err != nil {
+			return err
+		}
+		if *jsonOutput {
+			return printJSON(result)
+		}
+
+		table := newStatsTable("INBOUND", "OUTBOUND")
+		printStats(table, result, args[0], args[1])
+		return table.Flush()
+	}
+}
+
+func reset(args []string) error {
+	if len(args) == 1 {
+		return newClient().ResetInboundStats(args[0])
+	}
+	return newClient().ResetOutboundStats(args[0], args[1])
+}
+
+func codes(args []string) error {
+	if len(args) == 1 {
+		result, err := newClient().ReadInboundCodes(args[0])
+		if err != nil {
+			return err
+		}
+		if *jsonOutput {
+			return printJSON(result)
+		}
+
+		var outbounds []string
+		for outbound := range result {
+			outbounds = append(outbounds, outbound)
+		}
+		sort.Strings(outbounds)
+
+		table := newTable("OUTBOUND", "ACTIVE", "SHADOW", "REQUESTS")
+		for _, outbound := range outbounds {
+			printCodes(table, result[outbound], outbound)
+		}
+		return table.Flush()
+	}
+
+	result, err := newClient().ReadOutboundCodes(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if *jsonOutput {
+		return printJSON(result)
+	}
+
+	table := newTable("OUTBOUND", "ACTIVE", "SHADOW", "REQUESTS")
+	printCodes(table, result, args[1])
+	return table.Flush()
+}
+
+func printCodes(table io.Writer, matrix nfork.CodeMatrix, outbound string) {
+	var actives []string
+	for active := range matrix {
+		actives = append(actives, active)
+	}
+	sort.Strings(actives)
+
+	for _, active := range actives {
+		var shadows []string
+		for shadow := range matrix[active] {
+			shadows = append(shadows, shadow)
+		}
+		sort.Strings(shadows)
+
+		for _, shadow := range shadows {
+			row(table, outbound, active, shadow, matrix[active][shadow])
+		}
+	}
+}
+
+func history(args []string) error {
+	if len(args) == 1 {
+		result, err := newClient().ReadInboundHistory(args[0])
+		if err != nil {
+			return err
+		}
+		if *jsonOutput {
+			return printJSON(result)
+		}
+
+		var outbounds []string
+		for outbound := range result.Outbounds {
+			outbounds = append(outbounds, outbound)
+		}
+		sort.Strings(outbounds)
+
+		table := newStatsTable("TIME", "OUTBOUND")
+		printHistory(table, result.Inbound, "-")
+		for _, outbound := range outbounds {
+			printHistory(table, result.Outbounds[outbound], outbound)
+		}
+		return table.Flush()
+	}
+
+	result, err := newClient().ReadOutboundHistory(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if *jsonOutput {
+		return printJSON(result)
+	}
+
+	table := newStatsTable("TIME", "OUTBOUND")
+	printHistory(table, result, args[1])
+	return table.Flush()
+}
+
+func printHistory(table io.Writer, samples []*nfork.StatsSample, outbound string) {
+	for _, sample := range samples {
+		printStats(table, sample.Stats, sample.Time.Local().Format("15:04:05"), outbound)
+	}
+}
+
+func errorSamples(args []string) error {
+	result, err := newClient().ReadOutboundErrors(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if *jsonOutput {
+		return printJSON(result)
+	}
+
+	table := newTable("TIME", "CATEGORY", "METHOD", "PATH", "RESPONSE", "LATENCY", "REQUEST ID", "ERROR")
+	for _, sample := range result {
+		response, requestID := "-", "-"
+		if sample.Response > 0 {
+			response = strconv.Itoa(sample.Response)
+		}
+		if len(sample.RequestID) > 0 {
+			requestID = sample.RequestID
+		}
+
+		row(table,
+			sample.Time.Local().Format("15:04:05.000"), sample.Category,
+			sample.Method, sample.Path, response, formatLatency(uint64(sample.Latency)),
+			requestID, sample.Error)
+	}
+	return table.Flush()
+}
+
+func watch(args []string) error {
+	if args[0] == "watch" {
+		return fmt.Errorf("can't watch the watch command")
+	}
+
+	for {
+		var output bytes.Buffer
+		stdout := os.Stdout
+
+		// Commands print to os.Stdout so the output is captured through a
+		// pipe to redraw the screen in one go and avoid flickering.
+		reader, writer, err := os.Pipe()
+		if err != nil {
+			return err
+		}
+
+		copied := make(chan struct{})
+		go func() {
+			io.Copy(&output, reader)
+			close(copied)
+		}()
+
+		os.Stdout = writer
+		err = run(args)
+		os.Stdout = stdout
+
+		writer.Close()
+		<-copied
+		reader.Close()
+
+		fmt.Print("\033[H\033[2J")
+		fmt.Printf("Every %s: nforkctl %s  (%s)\n\n", *interval, strings.Join(args, " "), time.Now().Format(time.RFC1123))
+		output.WriteTo(os.Stdout)
+
+		if err != nil {
+			fmt.Printf("nforkctl: %s\n", err)
+		}
+
+		time.Sleep(*interval)
+	}
+}
+
+func newStatsTable(first, second string) *tabwriter.Writer {
+	return newTable(first, second,
+		"REQUESTS", "ERRORS", "TIMEOUTS", "2XX", "3XX", "4XX", "5XX", "P50", "P90", "P99", "MAX")
+}
+
+func printInboundStats(table io.Writer, inbound string, stats *nfork.InboundStats) {
+	var outbounds []string
+	for outbound := range stats.Outbounds {
+		outbounds = append(outbounds, outbound)
+	}
+	sort.Strings(outbounds)
+
+	printStats(table, stats.Inbound, inbound, "-")
+	for _, outbound := range outbounds {
+		printStats(table, stats.Outbounds[outbound], inbound, outbound)
+	}
+}
+
+func printStats(table io.Writer, stats *nfork.Stats, first, second string) {
+	if stats == nil {
+		stats = new(nfork.Stats)
+	}
+
+	var classes [6]uint64
+	for code, count := range stats.Responses {
+		if class := code / 100; class > 0 && class < len(classes) {
+			classes[class] += count
+		}
+	}
+
+	p50, p90, p99, max := stats.Latency.Percentiles()
+
+	row(table, first, second,
+		stats.Requests, stats.Errors, stats.Timeouts,
+		classes[2], classes[3], classes[4], classes[5],
+		formatLatency(p50), formatLatency(p90), formatLatency(p99), formatLatency(max))
+}
+
+// formatLatency rounds the given latency to keep the tables readable.
+func formatLatency(value uint64) string {
+	latency := time.Duration(value)
+
+	switch {
+	case latency >= time.Second:
+		latency = latency.Round(time.Millisecond)
+	case latency >= time.Millisecond:
+		latency = latency.Round(10 * time.Microsecond)
+	default:
+		latency = latency.Round(time.Microsecond)
+	}
+
+	return latency.String()
+}
+
+type inboundArray []*nfork.Inbound
+
+func (array inboundArray) Len() int           { return len(array) }
+func (array inboundArray) Swap(i, j int)      { array[i], array[j] = array[j], array[i] }
+func (array inboundArray) Less(i, j int) bool { return array[i].Name < array[j].Name }
@@ -11,6 +11,7 @@ import (
 	"flag"
 	"io/ioutil"
 	"log"
+	"net/http"
 	_ "net/http/pprof"
 )
 
@@ -19,9 +20,43 @@ var (
 		"config", "nfork.json",
 		"file containing initial description of routes")
 
+	state = flag.String(
+		"state", "",
+		"file where modifications made through the REST interface are persisted "+
+			"and restored from on startup; can be the same as --config")
+
+	push = flag.String(
+		"push", "",
+		"host:port of a StatsD or Carbon endpoint where stats are pushed")
+
+	pushNetwork = flag.String(
+		"push-network", "udp",
+		"network used to push stats: udp or tcp")
+
+	pushFormat = flag.String(
+		"push-format", nfork.FormatStatsD,
+		"format used to push stats: statsd or carbon")
+
+	pushTemplate = flag.String(
+		"push-template", nfork.DefaultPushTemplate,
+		"template used to name the pushed metrics")
+
+	traceFile = flag.String(
+		"trace-file", "",
+		"file where the spans of each request are appended as JSON lines or - for stdout")
+
+	traceCollector = flag.String(
+		"trace-collector", "",
+		"URL of an OTLP/HTTP collector where the spans of each request are sent")
+
 	listen = flag.String(
 		"listen", "0.0.0.0:9090",
 		"listen interface for the nfork controller interface")
+
+	auth = flag.String(
+		"auth", "",
+		"file containing the credentials allowed to use the nfork controller interface; "+
+			"the interface is open to anyone if not set")
 )
 
 func main() {
@@ -39,14 +74,67 @@ func main() {
 		log.Fatalf("unable to read file '%s': %s", *config, err.Error())
 	}
 
-	controller := new(nfork.Controller)
+	controller := &nfork.Controller{StateFile: *state}
 	if err := json.Unmarshal(body, &controller.Inbounds); err != nil {
 		log.Fatalf("unable to parse config '%s': %s", *config, err.Error())
 	}
 
+	if len(*push) > 0 {
+		pusher := &nfork.StatsPusher{
+			Addr:     *push,
+			Network:  *pushNetwork,
+			Format:   *pushFormat,
+			Template: *pushTemplate,
+		}
+		if err := pusher.Validate(); err != nil {
+			log.Fatalf("invalid push configuration: %s", err)
+		}
+
+		klog.KPrintf("init.info", "pushing %s stats to %s://%s\n", *pushFormat, *pushNetwork, *push)
+		controller.Publisher = pusher
+	}
+
+	if len(*traceFile) > 0 && len(*traceCollector) > 0 {
+		log.Fatalf("only one of --trace-file and --trace-collector can be set")
+	}
+
+	if len(*traceFile) > 0 {
+		klog.KPrintf("init.info", "writing spans to %s\n", *traceFile)
+		controller.Tracer = &nfork.SpanFile{Path: *traceFile}
+	}
+
+	if len(*traceCollector) > 0 {
+		collector := &nfork.SpanCollector{URL: *traceCollector}
+		if err := collector.Validate(); err != nil {
+			log.Fatalf("invalid trace configuration: %s", err)
+		}
+
+		klog.KPrintf("init.info", "sending spans to %s\n", *traceCollector)
+		controller.Tracer = collector
+	}
+
 	klog.KPrintf("init.info", "starting nfork control on %s\n", *listen)
 	controller.Start()
 
+	handler := controller.HTTPHandler(http.DefaultServeMux)
+
+	if len(*auth) > 0 {
+		creds, err := nfork.ReadCredentials(*auth)
+		if err != nil {
+			log.Fatalf("unable to read credentials: %s", err)
+		}
+
+		authHandler := &nfork.Auth{Credentials: creds}
+		if err := authHandler.Validate(); err != nil {
+			log.Fatalf("invalid credentials '%s': %s", *auth, err)
+		}
+
+		klog.KPrintf("init.info", "loaded %d credentials from %s\n", len(creds), *auth)
+		handler = authHandler.Handler(handler)
+	}
+
 	rest.AddService(controller)
-	rest.ListenAndServe(*listen, nil)
+	http.HandleFunc("/metrics", controller.ServeMetrics)
+	http.HandleFunc(nfork.DashboardPath, controller.ServeDashboard)
+	rest.ListenAndServe(*listen, handler)
 }